@@ -3,7 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
+	"strings"
 	"time"
 
 	ebiteninput "github.com/ebitenui/ebitenui/input"
@@ -16,6 +20,7 @@ import (
 	"github.com/quasilyte/sinecord/gamedata"
 	"github.com/quasilyte/sinecord/scenes"
 	"github.com/quasilyte/sinecord/session"
+	"github.com/quasilyte/sinecord/synthdb"
 )
 
 func main() {
@@ -31,8 +36,10 @@ func main() {
 	assets.RegisterResources(ctx)
 
 	keymap := input.Keymap{
-		controls.ActionBack:       {input.KeyEscape},
-		controls.ActionTogglePlay: {input.KeySpace},
+		controls.ActionBack:         {input.KeyEscape},
+		controls.ActionTogglePlay:   {input.KeySpace},
+		controls.ActionSeekBackward: {input.KeyLeft},
+		controls.ActionSeekForward:  {input.KeyRight},
 	}
 	state := &session.State{
 		Persistent: getDefaultData(),
@@ -62,6 +69,10 @@ func main() {
 
 	session.ReloadLanguage(ctx, "en")
 
+	if runtime.GOARCH != "wasm" {
+		loadUserSoundFonts(ctx)
+	}
+
 	tileset, err := gamedata.ParseTileset(ctx.Loader.LoadRaw(assets.RawLevelTilesetJSON).Data)
 	if err != nil {
 		panic(err)
@@ -110,6 +121,39 @@ func main() {
 	}
 }
 
+// loadUserSoundFonts registers the SF2 files from the game data "soundfonts" folder.
+func loadUserSoundFonts(ctx *ge.Context) {
+	dataPath := ctx.LocateGameData("soundfonts")
+	if dataPath == "" {
+		return
+	}
+	dir := filepath.Join(filepath.Dir(dataPath), "soundfonts")
+	files, err := filepath.Glob(filepath.Join(dir, "*.sf2"))
+	if err != nil {
+		fmt.Printf("can't list sound fonts: %v\n", err)
+		return
+	}
+	for _, filename := range files {
+		name := strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+		if synthdb.FindSoundFont(name).Name == name {
+			fmt.Printf("skip %q: duplicated sound font name\n", filename)
+			continue
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			fmt.Printf("can't load sound font: %v\n", err)
+			continue
+		}
+		sf, err := synthdb.LoadSoundFont(name, f)
+		f.Close()
+		if err != nil {
+			fmt.Printf("can't load sound font: %v\n", err)
+			continue
+		}
+		synthdb.RegisterSoundFont(sf)
+	}
+}
+
 func getDefaultData() session.PersistentData {
 	data := session.PersistentData{
 		VolumeLevel: 5,
@@ -0,0 +1,153 @@
+// sinecord-render renders a saved track without running the game.
+//
+// The input is a track JSON file: a save slot or a level solution.
+// The output format is inferred from the output file extension:
+//
+//	.wav - a 16-bit stereo PCM audio
+//	.mid - a Standard MIDI File
+//	.json - a notes list
+//
+// Usage example:
+//
+//	go run ./cmd/sinecord-render -soundfont TimGM6mb.sf2 -o track.wav track.json
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synth"
+	"github.com/quasilyte/sinecord/synthdb"
+	"github.com/sinshu/go-meltysynth/meltysynth"
+)
+
+func main() {
+	outputPath := flag.String("o", "", "output file path")
+	format := flag.String("format", "",
+		"output format: wav, mid or notes; inferred from the output file extension by default")
+	soundFontPath := flag.String("soundfont", filepath.Join("assets", "_data", "raw", "TimGM6mb.sf2"),
+		"SF2 file for the track sound font")
+	normalize := flag.Bool("normalize", true,
+		fmt.Sprintf("normalize the wav output loudness to %v LUFS", synth.DefaultLoudness))
+	flag.Parse()
+
+	if flag.NArg() != 1 || *outputPath == "" {
+		fmt.Fprintf(os.Stderr, "usage: sinecord-render [flags] -o output track.json\n")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	if *format == "" {
+		*format = formatByExtension(*outputPath)
+	}
+
+	if err := render(flag.Arg(0), *outputPath, *format, *soundFontPath, *normalize); err != nil {
+		fmt.Fprintf(os.Stderr, "sinecord-render: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func formatByExtension(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".mid", ".midi":
+		return "mid"
+	case ".json", ".txt":
+		return "notes"
+	default:
+		return "wav"
+	}
+}
+
+func render(trackPath, outputPath, format, soundFontPath string, normalize bool) error {
+	data, err := os.ReadFile(trackPath)
+	if err != nil {
+		return err
+	}
+	var track gamedata.Track
+	if err := json.Unmarshal(data, &track); err != nil {
+		return fmt.Errorf("decode %s: %w", trackPath, err)
+	}
+
+	sf, err := loadSoundFont(track.SoundFont, soundFontPath)
+	if err != nil {
+		return err
+	}
+
+	s, err := synth.LoadTrack(track, sf)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "wav":
+		var samples *synth.SampleSet
+		samples, _, err = s.CreatePCM(context.Background(), nil)
+		if err == nil {
+			if normalize {
+				samples.Normalize(synth.DefaultLoudness)
+			}
+			err = samples.WriteWAV(&buf)
+		}
+	case "mid":
+		err = s.WriteMIDI(&buf)
+	case "notes":
+		err = writeNotes(&buf, s.CreateNotes())
+	default:
+		return fmt.Errorf("unsupported %q output format", format)
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(outputPath, buf.Bytes(), 0o644)
+}
+
+// loadSoundFont resolves the track sound font.
+// The built-in fonts are only loaded from the file when they need the SF2 data.
+func loadSoundFont(name, filename string) (*synthdb.SoundFont, error) {
+	switch name {
+	case synthdb.Chiptune.Name:
+		return synthdb.Chiptune, nil
+
+	case "", synthdb.TimGM6mb.Name:
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		data, err := meltysynth.NewSoundFont(f)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", filename, err)
+		}
+		if err := synthdb.TimGM6mb.Load(data); err != nil {
+			return nil, err
+		}
+		return synthdb.TimGM6mb, nil
+
+	default:
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return synthdb.LoadSoundFont(name, f)
+	}
+}
+
+func writeNotes(w io.Writer, notes []synth.Note) error {
+	if notes == nil {
+		notes = []synth.Note{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(notes)
+}
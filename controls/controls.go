@@ -5,4 +5,6 @@ import "github.com/quasilyte/ge/input"
 const (
 	ActionBack input.Action = iota
 	ActionTogglePlay
+	ActionSeekBackward
+	ActionSeekForward
 )
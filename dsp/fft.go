@@ -0,0 +1,62 @@
+// Package dsp implements the audio signal analysis.
+//
+// It doesn't depend on the game graphics, so it can be used
+// (and tested) without a display.
+package dsp
+
+import (
+	"math"
+	"math/bits"
+)
+
+// FFT computes the discrete Fourier transform of x in place.
+//
+// It's an iterative radix-2 Cooley-Tukey implementation,
+// len(x) must be a power of two.
+func FFT(x []complex128) {
+	n := len(x)
+	if n&(n-1) != 0 {
+		panic("dsp.FFT: the input length is not a power of two")
+	}
+	if n < 2 {
+		return
+	}
+
+	// Bit-reversal permutation.
+	shift := 64 - bits.Len(uint(n-1))
+	for i := range x {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+
+	for size := 2; size <= n; size *= 2 {
+		half := size / 2
+		angle := -2 * math.Pi / float64(size)
+		step := complex(math.Cos(angle), math.Sin(angle))
+		for from := 0; from < n; from += size {
+			w := complex(1, 0)
+			for k := 0; k < half; k++ {
+				a := x[from+k]
+				b := w * x[from+k+half]
+				x[from+k] = a + b
+				x[from+k+half] = a - b
+				w *= step
+			}
+		}
+	}
+}
+
+// HannWindow returns the Hann window coefficients of the given size.
+func HannWindow(size int) []float64 {
+	window := make([]float64, size)
+	if size == 1 {
+		window[0] = 1
+		return window
+	}
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(size))
+	}
+	return window
+}
@@ -0,0 +1,151 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+type SpectrumConfig struct {
+	SampleRate int
+
+	// Size is the number of samples per analysis block.
+	// It must be a power of two.
+	Size int
+
+	// NumBands is the number of the log-spaced frequency bands.
+	NumBands int
+
+	// MinFreq and MaxFreq are the frequency range covered by the bands.
+	MinFreq float64
+	MaxFreq float64
+}
+
+// SpectrumAnalyzer computes the windowed FFT magnitudes
+// of the sample blocks and groups them into log-frequency bands.
+//
+// The Hann window is applied before the transform.
+// The magnitudes are scaled in a way that a sine of amplitude A
+// gives a peak of A (when its frequency is aligned with a bin).
+//
+// The analyzer reuses its buffers, it's not safe for a concurrent use.
+type SpectrumAnalyzer struct {
+	config SpectrumConfig
+
+	window     []float64
+	buf        []complex128
+	magnitudes []float64
+
+	// bands[i] is an inclusive bins range of the i-th band.
+	bands [][2]int
+}
+
+func NewSpectrumAnalyzer(config SpectrumConfig) *SpectrumAnalyzer {
+	a := &SpectrumAnalyzer{
+		config:     config,
+		window:     HannWindow(config.Size),
+		buf:        make([]complex128, config.Size),
+		magnitudes: make([]float64, config.Size/2+1),
+		bands:      make([][2]int, config.NumBands),
+	}
+
+	// A low frequency band can be narrower than a bin.
+	// Such band takes the bin that is the closest to its center.
+	for i := range a.bands {
+		from, to := a.BandRange(i)
+		fromBin := int(math.Ceil(from / a.BinWidth()))
+		toBin := int(math.Ceil(to/a.BinWidth())) - 1
+		if toBin < fromBin {
+			fromBin = int(math.Round(math.Sqrt(from*to) / a.BinWidth()))
+			toBin = fromBin
+		}
+		a.bands[i] = [2]int{
+			clampBin(fromBin, len(a.magnitudes)),
+			clampBin(toBin, len(a.magnitudes)),
+		}
+	}
+
+	return a
+}
+
+func clampBin(i, numBins int) int {
+	switch {
+	case i < 0:
+		return 0
+	case i >= numBins:
+		return numBins - 1
+	default:
+		return i
+	}
+}
+
+// BinWidth returns the frequency distance between the FFT bins.
+func (a *SpectrumAnalyzer) BinWidth() float64 {
+	return float64(a.config.SampleRate) / float64(a.config.Size)
+}
+
+// BandRange returns the [from, to) frequency range of the i-th band.
+func (a *SpectrumAnalyzer) BandRange(i int) (float64, float64) {
+	ratio := a.config.MaxFreq / a.config.MinFreq
+	n := float64(a.config.NumBands)
+	from := a.config.MinFreq * math.Pow(ratio, float64(i)/n)
+	to := a.config.MinFreq * math.Pow(ratio, float64(i+1)/n)
+	return from, to
+}
+
+// Magnitudes returns the spectrum of the first Size samples.
+// The missing samples are treated as silence.
+//
+// The result has Size/2+1 bins; the i-th bin frequency is i*BinWidth().
+// The returned slice is valid until the next analyzer call.
+func (a *SpectrumAnalyzer) Magnitudes(samples []float64) []float64 {
+	for i := range a.buf {
+		v := 0.0
+		if i < len(samples) {
+			v = samples[i] * a.window[i]
+		}
+		a.buf[i] = complex(v, 0)
+	}
+	FFT(a.buf)
+
+	// The Hann window halves the amplitude,
+	// the real signal energy is split between the two halves.
+	scale := 4 / float64(a.config.Size)
+	for i := range a.magnitudes {
+		a.magnitudes[i] = cmplx.Abs(a.buf[i]) * scale
+	}
+	return a.magnitudes
+}
+
+// Bands appends the band levels of the samples block to dst.
+// A band level is the max magnitude of its bins.
+func (a *SpectrumAnalyzer) Bands(dst, samples []float64) []float64 {
+	magnitudes := a.Magnitudes(samples)
+	for _, bins := range a.bands {
+		level := 0.0
+		for _, m := range magnitudes[bins[0] : bins[1]+1] {
+			level = math.Max(level, m)
+		}
+		dst = append(dst, level)
+	}
+	return dst
+}
+
+// Dominant finds the loudest source for every band.
+//
+// sources[i] are the band levels of the i-th source.
+// The result is appended to dst, it's -1 for the bands
+// that are silent in every source.
+func Dominant(dst []int, sources [][]float64, numBands int) []int {
+	for band := 0; band < numBands; band++ {
+		best := -1
+		bestLevel := 0.0
+		for i, levels := range sources {
+			if band < len(levels) && levels[band] > bestLevel {
+				best = i
+				bestLevel = levels[band]
+			}
+		}
+		dst = append(dst, best)
+	}
+	return dst
+}
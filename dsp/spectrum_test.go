@@ -0,0 +1,137 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+const testSampleRate = 44100
+
+func newTestSine(amplitude, freq float64, n int) []float64 {
+	samples := make([]float64, n)
+	for i := range samples {
+		samples[i] = amplitude * math.Sin(2*math.Pi*freq*float64(i)/testSampleRate)
+	}
+	return samples
+}
+
+func newTestAnalyzer() *SpectrumAnalyzer {
+	return NewSpectrumAnalyzer(SpectrumConfig{
+		SampleRate: testSampleRate,
+		Size:       2048,
+		NumBands:   48,
+		MinFreq:    40,
+		MaxFreq:    16000,
+	})
+}
+
+func TestFFT(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, n := range []int{1, 2, 4, 8, 64, 256} {
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(r.Float64()*2-1, r.Float64()*2-1)
+		}
+		// The naive O(n^2) DFT.
+		want := make([]complex128, n)
+		for k := range want {
+			for i, v := range x {
+				angle := -2 * math.Pi * float64(k*i) / float64(n)
+				want[k] += v * complex(math.Cos(angle), math.Sin(angle))
+			}
+		}
+		FFT(x)
+		for k := range x {
+			if cmplx.Abs(x[k]-want[k]) > 1e-9 {
+				t.Fatalf("n=%d bin %d: have %v, want %v", n, k, x[k], want[k])
+			}
+		}
+	}
+}
+
+func TestSpectrumMagnitudes(t *testing.T) {
+	a := newTestAnalyzer()
+
+	// A sine aligned with the bin 93.
+	const bin = 93
+	freq := bin * a.BinWidth()
+	magnitudes := a.Magnitudes(newTestSine(0.5, freq, 2048))
+	if math.Abs(magnitudes[bin]-0.5) > 1e-6 {
+		t.Fatalf("peak magnitude: have %f, want 0.5", magnitudes[bin])
+	}
+	// The Hann window spreads the peak to the adjacent bins only.
+	for _, i := range []int{bin - 1, bin + 1} {
+		if math.Abs(magnitudes[i]-0.25) > 1e-6 {
+			t.Fatalf("bin %d magnitude: have %f, want 0.25", i, magnitudes[i])
+		}
+	}
+	for i, m := range magnitudes {
+		if (i < bin-1 || i > bin+1) && m > 1e-6 {
+			t.Fatalf("bin %d magnitude: have %f, want 0", i, m)
+		}
+	}
+
+	// The missing samples are zeros.
+	for _, m := range a.Magnitudes(nil) {
+		if m != 0 {
+			t.Fatal("silence has a non-zero spectrum")
+		}
+	}
+}
+
+func TestSpectrumBands(t *testing.T) {
+	a := newTestAnalyzer()
+
+	for _, freq := range []float64{55, 110, 261.63, 440, 1000, 3520, 7040, 12000} {
+		levels := a.Bands(nil, newTestSine(0.8, freq, 2048))
+		if len(levels) != 48 {
+			t.Fatalf("%.2f Hz: have %d bands", freq, len(levels))
+		}
+		loudest := 0
+		for i, level := range levels {
+			if level > levels[loudest] {
+				loudest = i
+			}
+		}
+		// The loudest band must contain the sine frequency.
+		// A peak is one bin wide, so it may land into a neighbour band.
+		from, to := a.BandRange(loudest)
+		if freq < from-a.BinWidth() || freq >= to+a.BinWidth() {
+			t.Fatalf("%.2f Hz: the loudest band is %d [%.2f, %.2f)", freq, loudest, from, to)
+		}
+		if levels[loudest] < 0.8/2 {
+			t.Fatalf("%.2f Hz: the peak level is too low: %f", freq, levels[loudest])
+		}
+	}
+}
+
+func TestDominant(t *testing.T) {
+	a := newTestAnalyzer()
+
+	bass := a.Bands(nil, newTestSine(0.8, 110, 2048))
+	lead := a.Bands(nil, newTestSine(0.3, 3000, 2048))
+
+	loudestBand := func(levels []float64) int {
+		loudest := 0
+		for i, level := range levels {
+			if level > levels[loudest] {
+				loudest = i
+			}
+		}
+		return loudest
+	}
+	dominant := Dominant(nil, [][]float64{bass, lead}, len(bass))
+	if band := loudestBand(bass); dominant[band] != 0 {
+		t.Fatalf("band %d: have %d dominant, want 0", band, dominant[band])
+	}
+	if band := loudestBand(lead); dominant[band] != 1 {
+		t.Fatalf("band %d: have %d dominant, want 1", band, dominant[band])
+	}
+
+	dominant = Dominant(nil, [][]float64{{0, 1, 0}, {0, 0.5, 2}}, 3)
+	if dominant[0] != -1 || dominant[1] != 0 || dominant[2] != 1 {
+		t.Fatalf("unexpected result: %v", dominant)
+	}
+}
@@ -381,6 +381,9 @@ type SelectButtonConfig struct {
 	ValueNames     []string
 	DisabledValues []int
 
+	// IsDisabled is like DisabledValues, but it's checked on every click.
+	IsDisabled func(value int) bool
+
 	MinWidth int
 
 	Tooltip *widget.Container
@@ -429,16 +432,22 @@ func NewSelectButton(config SelectButtonConfig) *widget.Button {
 			}
 		}
 
-		for {
+		// Every value is tried at most once, so the current value
+		// is selected again if all other values are disabled.
+		for i := 0; i <= maxValue; i++ {
 			if increase {
 				slider.Inc()
 			} else {
 				slider.Dec()
 			}
 			*value = slider.Value()
-			if !xslices.Contains(config.DisabledValues, *value) {
-				break
+			if xslices.Contains(config.DisabledValues, *value) {
+				continue
+			}
+			if config.IsDisabled != nil && config.IsDisabled(*value) {
+				continue
 			}
+			break
 		}
 
 		button.Text().Label = makeLabel()
@@ -18,6 +18,12 @@ func (r *FuncRunner) UsesFunc(name string) bool {
 	return xslices.Contains(r.funcsUsed, name)
 }
 
+// NumNodes reports the expression size.
+// Every operand, operator and function call is a node, the parentheses are not.
+func (r *FuncRunner) NumNodes() int {
+	return len(r.insts)
+}
+
 func (r *FuncRunner) Run(x float64) float64 {
 	r.stack = r.stack[:0]
 
@@ -6,15 +6,42 @@ import (
 	"go/parser"
 	"go/token"
 	"math"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/quasilyte/gmath"
 )
 
 func Compile(src string) (*FuncRunner, error) {
+	return CompileWithConsts(src, nil)
+}
+
+// CompileWithConsts is like Compile, but the expression can also
+// refer to the named constants.
+//
+// A constant name can start with a digit, like "16th".
+// Such names are not valid identifiers, so they're replaced
+// with the "_"-prefixed versions before the parsing.
+// A name preceded by a digit or a dot is a part of a number, like "0.16th",
+// it's not replaced and results in a syntax error.
+func CompileWithConsts(src string, consts map[string]float64) (*FuncRunner, error) {
 	var c compiler
 	c.src = src
 	c.funcSet = make(map[string]struct{})
+	if len(consts) != 0 {
+		c.consts = make(map[string]float64, len(consts))
+		for name, v := range consts {
+			if name != "" && name[0] >= '0' && name[0] <= '9' {
+				// Go regexp has no lookbehind, so the preceding
+				// character is captured and put back.
+				re := regexp.MustCompile(`(^|[^\w.])` + regexp.QuoteMeta(name) + `\b`)
+				c.src = re.ReplaceAllString(c.src, "${1}_"+name)
+				name = "_" + name
+			}
+			c.consts[name] = v
+		}
+	}
 	runner, err := c.CompileRoot()
 	if err != nil {
 		return nil, err
@@ -29,6 +56,7 @@ type compiler struct {
 	constants     []float64
 	constantsPool map[float64]uint8
 	funcSet       map[string]struct{}
+	consts        map[string]float64
 }
 
 func (c *compiler) CompileRoot() (runner *FuncRunner, err error) {
@@ -147,7 +175,11 @@ func (c *compiler) compileIdent(e *ast.Ident) {
 	case "eps":
 		c.emit1(opFloatConst, c.internConst(gmath.Epsilon))
 	default:
-		c.throwf("unknown variable %q", e.Name)
+		v, ok := c.consts[e.Name]
+		if !ok {
+			c.throwf("unknown variable %q", strings.TrimPrefix(e.Name, "_"))
+		}
+		c.emit1(opFloatConst, c.internConst(v))
 	}
 }
 
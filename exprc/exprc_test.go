@@ -2,6 +2,7 @@ package exprc
 
 import (
 	"math"
+	"strings"
 	"testing"
 )
 
@@ -142,3 +143,77 @@ func TestSimple(t *testing.T) {
 		}
 	}
 }
+
+func TestConsts(t *testing.T) {
+	consts := map[string]float64{
+		"beat": 0.5,
+		"16th": 0.125,
+	}
+
+	tests := []struct {
+		src    string
+		result float64
+	}{
+		{src: "beat", result: 0.5},
+		{src: "beat/2", result: 0.25},
+		{src: "16th", result: 0.125},
+		{src: "3*16th", result: 0.375},
+		{src: "16th+beat", result: 0.625},
+		{src: "16", result: 16},
+		{src: "(16th)*2", result: 0.25},
+		{src: "16th-16th", result: 0},
+		{src: "-16th", result: -0.125},
+	}
+
+	for _, test := range tests {
+		f, err := CompileWithConsts(test.src, consts)
+		if err != nil {
+			t.Fatalf("%q: %v", test.src, err)
+		}
+		if result := f.Run(0); result != test.result {
+			t.Fatalf("%q:\nwant: %v\nhave: %v", test.src, test.result, result)
+		}
+	}
+
+	_, err := Compile("beat")
+	if err == nil || err.Error() != `unknown variable "beat"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = CompileWithConsts("bar", consts)
+	if err == nil || err.Error() != `unknown variable "bar"` {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The constant can't be a part of a number.
+	// The source is not rewritten, so the error doesn't mention "_16th".
+	for _, src := range []string{"0.16th", "216th", "x*1.16th"} {
+		_, err := CompileWithConsts(src, consts)
+		if err == nil || strings.Contains(err.Error(), "_") {
+			t.Fatalf("%q: unexpected error: %v", src, err)
+		}
+	}
+}
+
+func TestNumNodes(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		{src: "1", want: 1},
+		{src: "(x)", want: 1},
+		{src: "-x", want: 2},
+		{src: "x*2 + 1", want: 5},
+		{src: "sin(x) * 2", want: 4},
+		{src: "((x + 1))", want: 3},
+	}
+
+	for _, test := range tests {
+		fn, err := Compile(test.src)
+		if err != nil {
+			t.Fatalf("%s: %v", test.src, err)
+		}
+		if have := fn.NumNodes(); have != test.want {
+			t.Fatalf("%s: have %d nodes, want %d", test.src, have, test.want)
+		}
+	}
+}
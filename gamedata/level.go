@@ -7,6 +7,7 @@ import (
 
 	"github.com/quasilyte/ge/tiled"
 	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/exprc"
 )
 
 type LevelBonusObjectives struct {
@@ -24,6 +25,8 @@ type LevelData struct {
 
 	Targets []Target
 
+	Obstacles []Obstacle
+
 	ActNumber     int
 	MissionNumber int
 
@@ -54,6 +57,7 @@ func ParseLevel(tileset *tiled.Tileset, scaler *PlotScaler, jsonData []byte) (*L
 
 	var systemLayer *tiled.MapLayer
 	var targetsLayer *tiled.MapLayer
+	var obstaclesLayer *tiled.MapLayer
 	for i := range m.Layers {
 		l := &m.Layers[i]
 		switch l.Name {
@@ -61,6 +65,8 @@ func ParseLevel(tileset *tiled.Tileset, scaler *PlotScaler, jsonData []byte) (*L
 			targetsLayer = l
 		case "system":
 			systemLayer = l
+		case "obstacles":
+			obstaclesLayer = l
 		}
 	}
 
@@ -140,13 +146,115 @@ func ParseLevel(tileset *tiled.Tileset, scaler *PlotScaler, jsonData []byte) (*L
 			return nil, fmt.Errorf("unexpected target size: %dx%d", o.Width, o.Height)
 		}
 
-		result.Targets = append(result.Targets, Target{
+		motion, err := parseTargetMotion(&o)
+		if err != nil {
+			return nil, fmt.Errorf("target at %d,%d: %w", o.X, o.Y, err)
+		}
+
+		target := Target{
 			Pos:        scaler.TranslateTiledPos(tileset, gmath.Vec{X: x, Y: y}),
 			Instrument: instrumentMap[class],
 			Size:       size,
 			Outline:    outline,
-		})
+			Motion:     motion,
+			TimeFrom:   o.GetFloatProp("t_from", 0),
+			TimeTo:     o.GetFloatProp("t_to", 0),
+			Order:      o.GetIntProp("order", 0),
+			Shield:     o.GetIntProp("shield", 0),
+		}
+		if target.TimeFrom < 0 || (target.TimeTo != 0 && target.TimeTo <= target.TimeFrom) {
+			return nil, fmt.Errorf("target at %d,%d: invalid [%v, %v] time window", o.X, o.Y, target.TimeFrom, target.TimeTo)
+		}
+		if target.Order < 0 {
+			return nil, fmt.Errorf("target at %d,%d: an *order* can't be negative", o.X, o.Y)
+		}
+		if target.Shield < 0 || target.Shield == 1 {
+			return nil, fmt.Errorf("target at %d,%d: a *shield* should be at least 2", o.X, o.Y)
+		}
+		if target.Shield > result.MaxInstruments {
+			return nil, fmt.Errorf("target at %d,%d: a *shield* can't exceed *max_instruments*", o.X, o.Y)
+		}
+		result.Targets = append(result.Targets, target)
+	}
+
+	// The obstacles layer is optional.
+	if obstaclesLayer != nil {
+		for _, o := range obstaclesLayer.Objects {
+			if o.Width <= 0 || o.Height <= 0 {
+				return nil, fmt.Errorf("obstacle at %d,%d: expected a rectangle object", o.X, o.Y)
+			}
+			kindName := o.GetStringProp("kind", "wall")
+			kind, ok := obstacleKindNames[kindName]
+			if !ok {
+				return nil, fmt.Errorf("obstacle at %d,%d: unexpected kind: %q", o.X, o.Y, kindName)
+			}
+			result.Obstacles = append(result.Obstacles, Obstacle{
+				Kind: kind,
+				Rect: scaler.TranslateTiledRect(float64(o.X), float64(o.Y), float64(o.Width), float64(o.Height)),
+			})
+		}
 	}
 
 	return &result, nil
 }
+
+// parseTargetMotion reads the target trajectory from the object properties:
+//
+//	motion - "linear", "circle" or "formula"; the target is static by default
+//	motion_dx, motion_dy - a linear motion offset
+//	motion_radius - a circular motion radius
+//	motion_period - a linear or circular motion cycle duration in seconds
+//	motion_x, motion_y - the formula motion offsets
+func parseTargetMotion(o *tiled.Object) (TargetMotion, error) {
+	var motion TargetMotion
+
+	kind := o.GetStringProp("motion", "")
+	switch kind {
+	case "":
+		return motion, nil
+
+	case "linear":
+		motion.Kind = LinearMotion
+		motion.Offset = gmath.Vec{
+			X: o.GetFloatProp("motion_dx", 0),
+			Y: o.GetFloatProp("motion_dy", 0),
+		}
+
+	case "circle":
+		motion.Kind = CircularMotion
+		motion.Radius = o.GetFloatProp("motion_radius", 0)
+		if motion.Radius <= 0 {
+			return motion, errors.New("a *motion_radius* should be positive")
+		}
+
+	case "formula":
+		motion.Kind = FormulaMotion
+		for _, f := range []struct {
+			prop string
+			dst  **exprc.FuncRunner
+		}{
+			{"motion_x", &motion.FuncX},
+			{"motion_y", &motion.FuncY},
+		} {
+			src := strings.TrimSpace(o.GetStringProp(f.prop, ""))
+			if src == "" {
+				continue
+			}
+			fn, err := exprc.Compile(strings.ToLower(src))
+			if err != nil {
+				return motion, fmt.Errorf("%s: %w", f.prop, err)
+			}
+			*f.dst = fn
+		}
+		return motion, nil
+
+	default:
+		return motion, fmt.Errorf("unexpected motion kind: %q", kind)
+	}
+
+	motion.Period = o.GetFloatProp("motion_period", 4)
+	if motion.Period <= 0 {
+		return motion, errors.New("a *motion_period* should be positive")
+	}
+	return motion, nil
+}
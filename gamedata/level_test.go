@@ -0,0 +1,255 @@
+package gamedata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/gmath"
+)
+
+var testScaler = &PlotScaler{
+	Factor: 46,
+	Offset: gmath.Vec{X: 4, Y: 46 * 3},
+}
+
+// parseTestLevel parses a map with the given targets and obstacles.
+// Both arguments are the Tiled JSON objects lists.
+// The level allows up to 3 instruments.
+func parseTestLevel(t *testing.T, targets, obstacles string) (*LevelData, error) {
+	t.Helper()
+
+	tilesetData, err := os.ReadFile(filepath.Join("..", "assets", "_data", "raw", "leveledit.tsj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileset, err := ParseTileset(tilesetData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapData := `{
+		"tilesets": [{"firstgid": 1, "source": "leveledit.tsj"}],
+		"layers": [
+			{"name": "system", "objects": [
+				{"gid": 11, "x": 0, "y": 46, "width": 46, "height": 46, "properties": [
+					{"name": "name", "type": "string", "value": "test"},
+					{"name": "description", "type": "string", "value": "a test level"},
+					{"name": "max_instruments", "type": "int", "value": 3}
+				]}
+			]},
+			{"name": "targets", "objects": [` + targets + `]},
+			{"name": "obstacles", "objects": [` + obstacles + `]}
+		]
+	}`
+	return ParseLevel(tileset, testScaler, []byte(mapData))
+}
+
+// testTarget returns a normal size target object with the given properties.
+func testTarget(props string) string {
+	return `{"gid": 8, "x": 92, "y": 92, "width": 46, "height": 46, "properties": [` + props + `]}`
+}
+
+func TestParseLevelMotion(t *testing.T) {
+	tests := []struct {
+		props string
+		want  TargetMotion
+	}{
+		{``, TargetMotion{}},
+		{
+			`{"name": "motion", "type": "string", "value": "linear"},
+			{"name": "motion_dx", "type": "float", "value": 2},
+			{"name": "motion_dy", "type": "float", "value": -1},
+			{"name": "motion_period", "type": "float", "value": 3}`,
+			TargetMotion{Kind: LinearMotion, Offset: gmath.Vec{X: 2, Y: -1}, Period: 3},
+		},
+		{
+			`{"name": "motion", "type": "string", "value": "circle"},
+			{"name": "motion_radius", "type": "float", "value": 1.5}`,
+			TargetMotion{Kind: CircularMotion, Radius: 1.5, Period: 4},
+		},
+	}
+	for _, test := range tests {
+		level, err := parseTestLevel(t, testTarget(test.props), ``)
+		if err != nil {
+			t.Fatalf("%s: %v", test.props, err)
+		}
+		if have := level.Targets[0].Motion; have != test.want {
+			t.Fatalf("%s:\nhave %+v\nwant %+v", test.props, have, test.want)
+		}
+	}
+
+	t.Run("formula", func(t *testing.T) {
+		level, err := parseTestLevel(t, testTarget(`
+			{"name": "motion", "type": "string", "value": "formula"},
+			{"name": "motion_y", "type": "string", "value": " Sin(x) "}`), ``)
+		if err != nil {
+			t.Fatal(err)
+		}
+		motion := level.Targets[0].Motion
+		if motion.Kind != FormulaMotion || motion.FuncX != nil || motion.FuncY == nil {
+			t.Fatalf("unexpected motion: %+v", motion)
+		}
+	})
+
+	errorTests := []struct {
+		props string
+		err   string
+	}{
+		{
+			`{"name": "motion", "type": "string", "value": "zigzag"}`,
+			`unexpected motion kind: "zigzag"`,
+		},
+		{
+			`{"name": "motion", "type": "string", "value": "linear"},
+			{"name": "motion_period", "type": "float", "value": 0}`,
+			"*motion_period* should be positive",
+		},
+		{
+			`{"name": "motion", "type": "string", "value": "circle"},
+			{"name": "motion_radius", "type": "float", "value": 1},
+			{"name": "motion_period", "type": "float", "value": -2}`,
+			"*motion_period* should be positive",
+		},
+		{
+			`{"name": "motion", "type": "string", "value": "circle"}`,
+			"*motion_radius* should be positive",
+		},
+		{
+			`{"name": "motion", "type": "string", "value": "circle"},
+			{"name": "motion_radius", "type": "float", "value": -1}`,
+			"*motion_radius* should be positive",
+		},
+		{
+			`{"name": "motion", "type": "string", "value": "formula"},
+			{"name": "motion_x", "type": "string", "value": "sin("}`,
+			"motion_x: ",
+		},
+	}
+	for _, test := range errorTests {
+		_, err := parseTestLevel(t, testTarget(test.props), ``)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.props)
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: have %q, want %q", test.props, err, test.err)
+		}
+	}
+}
+
+func TestParseLevelTargetRules(t *testing.T) {
+	level, err := parseTestLevel(t, testTarget(`
+		{"name": "t_from", "type": "float", "value": 1.5},
+		{"name": "t_to", "type": "float", "value": 4},
+		{"name": "order", "type": "int", "value": 2},
+		{"name": "shield", "type": "int", "value": 3}`), ``)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := level.Targets[0]
+	if target.TimeFrom != 1.5 || target.TimeTo != 4 || target.Order != 2 || target.Shield != 3 {
+		t.Fatalf("unexpected target: %+v", target)
+	}
+
+	tests := []struct {
+		props string
+		err   string
+	}{
+		{
+			`{"name": "t_from", "type": "float", "value": -1}`,
+			"invalid [-1, 0] time window",
+		},
+		{
+			`{"name": "t_from", "type": "float", "value": 2},
+			{"name": "t_to", "type": "float", "value": 1}`,
+			"invalid [2, 1] time window",
+		},
+		{
+			`{"name": "t_from", "type": "float", "value": 2},
+			{"name": "t_to", "type": "float", "value": 2}`,
+			"invalid [2, 2] time window",
+		},
+		{
+			`{"name": "order", "type": "int", "value": -1}`,
+			"*order* can't be negative",
+		},
+		{
+			`{"name": "shield", "type": "int", "value": 1}`,
+			"*shield* should be at least 2",
+		},
+		{
+			`{"name": "shield", "type": "int", "value": -2}`,
+			"*shield* should be at least 2",
+		},
+		{
+			`{"name": "shield", "type": "int", "value": 4}`,
+			"*shield* can't exceed *max_instruments*",
+		},
+	}
+	for _, test := range tests {
+		_, err := parseTestLevel(t, testTarget(test.props), ``)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.props)
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: have %q, want %q", test.props, err, test.err)
+		}
+	}
+}
+
+func TestParseLevelObstacles(t *testing.T) {
+	level, err := parseTestLevel(t, testTarget(``), `
+		{"x": 46, "y": 92, "width": 92, "height": 23},
+		{"x": 46, "y": 92, "width": 92, "height": 23, "properties": [
+			{"name": "kind", "type": "string", "value": "mirror"}
+		]},
+		{"x": 230, "y": 46, "width": 46, "height": 138, "properties": [
+			{"name": "kind", "type": "string", "value": "mute"}
+		]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Obstacle{
+		{Kind: WallObstacle, Rect: testScaler.TranslateTiledRect(46, 92, 92, 23)},
+		{Kind: MirrorObstacle, Rect: testScaler.TranslateTiledRect(46, 92, 92, 23)},
+		{Kind: MuteObstacle, Rect: testScaler.TranslateTiledRect(230, 46, 46, 138)},
+	}
+	if len(level.Obstacles) != len(want) {
+		t.Fatalf("have %d obstacles, want %d", len(level.Obstacles), len(want))
+	}
+	for i, o := range level.Obstacles {
+		if o != want[i] {
+			t.Fatalf("obstacle[%d]:\nhave %+v\nwant %+v", i, o, want[i])
+		}
+	}
+
+	tests := []struct {
+		obstacle string
+		err      string
+	}{
+		{
+			`{"x": 46, "y": 92, "width": 92, "height": 23, "properties": [
+				{"name": "kind", "type": "string", "value": "glass"}
+			]}`,
+			`obstacle at 46,92: unexpected kind: "glass"`,
+		},
+		{
+			`{"x": 46, "y": 92, "width": 0, "height": 0, "point": true}`,
+			"obstacle at 46,92: expected a rectangle object",
+		},
+		{
+			`{"x": 46, "y": 92, "width": 0, "height": 0, "polygon": [{"x": 0, "y": 0}, {"x": 46, "y": 0}, {"x": 0, "y": 46}]}`,
+			"obstacle at 46,92: expected a rectangle object",
+		},
+	}
+	for _, test := range tests {
+		_, err := parseTestLevel(t, testTarget(``), test.obstacle)
+		if err == nil {
+			t.Fatalf("%s: expected an error", test.obstacle)
+		}
+		if !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("%s: have %q, want %q", test.obstacle, err, test.err)
+		}
+	}
+}
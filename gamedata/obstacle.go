@@ -0,0 +1,48 @@
+package gamedata
+
+import (
+	"github.com/quasilyte/gmath"
+)
+
+type ObstacleKind int
+
+const (
+	// WallObstacle stops the waves from growing.
+	WallObstacle ObstacleKind = iota
+
+	// MirrorObstacle stops the waves like a wall,
+	// but the waves are reflected back from it.
+	MirrorObstacle
+
+	// MuteObstacle is a zone where the notes are not played.
+	MuteObstacle
+)
+
+var obstacleKindNames = map[string]ObstacleKind{
+	"wall":   WallObstacle,
+	"mirror": MirrorObstacle,
+	"mute":   MuteObstacle,
+}
+
+type Obstacle struct {
+	Kind ObstacleKind
+
+	// Rect is an obstacle area in the canvas pixels.
+	Rect gmath.Rect
+}
+
+// MuteZones returns the mute obstacle areas in the plot units.
+// See synth.Program.MuteZones.
+func MuteZones(obstacles []Obstacle, scaler *PlotScaler) []gmath.Rect {
+	var zones []gmath.Rect
+	for _, o := range obstacles {
+		if o.Kind != MuteObstacle {
+			continue
+		}
+		// The plot Y axis is inverted.
+		from := scaler.UnscalePos(gmath.Vec{X: o.Rect.Min.X, Y: o.Rect.Max.Y})
+		to := scaler.UnscalePos(gmath.Vec{X: o.Rect.Max.X, Y: o.Rect.Min.Y})
+		zones = append(zones, gmath.Rect{Min: from, Max: to})
+	}
+	return zones
+}
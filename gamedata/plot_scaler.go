@@ -17,6 +17,16 @@ func (s *PlotScaler) TranslateTiledPos(tileset *tiled.Tileset, pos gmath.Vec) gm
 	}
 }
 
+// TranslateTiledRect converts the Tiled rectangle object bounds to the canvas pixels.
+// Unlike the tile objects, the rectangles are anchored at their top-left corner.
+func (s *PlotScaler) TranslateTiledRect(x, y, width, height float64) gmath.Rect {
+	from := gmath.Vec{X: x + s.Offset.X, Y: y}
+	return gmath.Rect{
+		Min: from,
+		Max: from.Add(gmath.Vec{X: width, Y: height}),
+	}
+}
+
 func (s *PlotScaler) ScaleXY(x, y float64) gmath.Vec {
 	return s.ScalePos(gmath.Vec{X: x, Y: y})
 }
@@ -28,3 +38,22 @@ func (s *PlotScaler) ScalePos(pos gmath.Vec) gmath.Vec {
 	}
 	return pos.Add(s.Offset)
 }
+
+// ScaleOffset converts the plot units displacement to the pixels.
+// Unlike ScalePos, it doesn't apply the plot offset.
+func (s *PlotScaler) ScaleOffset(offset gmath.Vec) gmath.Vec {
+	return gmath.Vec{
+		X: offset.X * s.Factor,
+		Y: -(offset.Y * s.Factor),
+	}
+}
+
+// UnscalePos converts the canvas pixels position to the plot units.
+// It's an inverse of ScalePos.
+func (s *PlotScaler) UnscalePos(pos gmath.Vec) gmath.Vec {
+	pos = pos.Sub(s.Offset)
+	return gmath.Vec{
+		X: pos.X / s.Factor,
+		Y: -(pos.Y / s.Factor),
+	}
+}
@@ -1,7 +1,10 @@
 package gamedata
 
 import (
+	"math"
+
 	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/exprc"
 )
 
 type TargetSize int
@@ -13,6 +16,8 @@ const (
 )
 
 type Target struct {
+	// Pos is a target position without the motion offset.
+	// It's a circle center for a circular motion.
 	Pos gmath.Vec
 
 	Instrument InstrumentKind
@@ -20,4 +25,91 @@ type Target struct {
 	Outline bool
 
 	Size TargetSize
+
+	Motion TargetMotion
+
+	// TimeFrom and TimeTo limit the time when the target can be hit.
+	// A zero TimeTo means there is no upper limit.
+	TimeFrom float64
+	TimeTo   float64
+
+	// Order is a 1-based number of the ordered target.
+	// The ordered targets must be hit in the increasing order.
+	// A zero value means that the target can be hit at any moment.
+	Order int
+
+	// Shield is a number of the different instruments
+	// that need to hit the target to destroy it.
+	// A zero value means that the target is not shielded.
+	Shield int
+}
+
+// IsWindowed reports whether the target hit time is limited.
+func (t *Target) IsWindowed() bool {
+	return t.TimeFrom != 0 || t.TimeTo != 0
+}
+
+type TargetMotionKind int
+
+const (
+	StaticTarget TargetMotionKind = iota
+
+	// LinearMotion moves the target to the Offset point and back.
+	LinearMotion
+
+	// CircularMotion moves the target counter-clockwise
+	// along a circle of the Radius.
+	CircularMotion
+
+	// FormulaMotion moves the target by the FuncX and FuncY offsets.
+	// The formulas argument is the program time.
+	FormulaMotion
+)
+
+// TargetMotion describes a target trajectory.
+// All distances are in the plot units (like the instrument functions values).
+type TargetMotion struct {
+	Kind TargetMotionKind
+
+	Offset gmath.Vec
+
+	Radius float64
+
+	// Period is a duration of the full linear or circular motion cycle.
+	Period float64
+
+	// FuncX and FuncY can be nil, it means a zero offset.
+	FuncX *exprc.FuncRunner
+	FuncY *exprc.FuncRunner
+}
+
+// OffsetAt returns the target displacement at the moment t.
+func (m *TargetMotion) OffsetAt(t float64) gmath.Vec {
+	switch m.Kind {
+	case LinearMotion:
+		// A triangle wave: 0 -> 1 -> 0 during the period.
+		phase := math.Mod(t/m.Period, 1)
+		k := 1 - math.Abs(2*phase-1)
+		return m.Offset.Mulf(k)
+
+	case CircularMotion:
+		angle := 2 * math.Pi * t / m.Period
+		return gmath.Vec{
+			X: m.Radius * math.Cos(angle),
+			Y: m.Radius * math.Sin(angle),
+		}
+
+	case FormulaMotion:
+		var offset gmath.Vec
+		if m.FuncX != nil {
+			offset.X = m.FuncX.Run(t)
+		}
+		if m.FuncY != nil {
+			offset.Y = m.FuncY.Run(t)
+		}
+		return offset
+
+	default:
+		return gmath.Vec{}
+	}
 }
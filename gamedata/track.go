@@ -3,8 +3,6 @@ package gamedata
 import (
 	"fmt"
 	"time"
-
-	"github.com/quasilyte/ge"
 )
 
 type Track struct {
@@ -14,6 +12,23 @@ type Track struct {
 
 	Instruments []InstrumentSettings `json:"instruments"`
 
+	// ScaleRoot and ScaleMode describe the musical scale
+	// every note is snapped to (see synthdb.Scale).
+	// Empty values mean a chromatic scale.
+	ScaleRoot string `json:"scale_root"`
+	ScaleMode string `json:"scale_mode"`
+
+	// BPM, TimeSignature and SnapToGrid describe the track
+	// musical grid (see synthdb.Tempo).
+	// Empty values mean a 120 BPM 4/4 tempo.
+	BPM           float64 `json:"bpm,omitempty"`
+	TimeSignature string  `json:"time_signature,omitempty"`
+	SnapToGrid    bool    `json:"snap_to_grid,omitempty"`
+
+	// SoundFont is a name of the font the instruments belong to.
+	// An empty value means the default font.
+	SoundFont string `json:"sound_font,omitempty"`
+
 	Slot int
 }
 
@@ -28,27 +43,13 @@ func (t *Track) IsEmpty() bool {
 type InstrumentSettings struct {
 	Function       string  `json:"function"`
 	PeriodFunction string  `json:"period_function"`
+	GateFunction   string  `json:"gate_function"`
+	PanFunction    string  `json:"pan_function"`
+	Chord          string  `json:"chord,omitempty"`
+	Glide          int     `json:"glide,omitempty"`
 	Volume         float64 `json:"volume"`
+	ReverbSend     float64 `json:"reverb_send"`
+	ChorusSend     float64 `json:"chorus_send"`
 	InstrumentName string  `json:"instrument_name"`
 	Enabled        bool    `json:"enabled"`
 }
-
-func DiscoverTracks(ctx *ge.Context) []Track {
-	tracks := make([]Track, 10)
-
-	for i := range tracks {
-		t := &tracks[i]
-		t.Slot = i + 1
-		key := t.FileName()
-		if !ctx.CheckGameData(key) {
-			continue
-		}
-		if err := ctx.LoadGameData(key, &t); err != nil {
-			fmt.Printf("load %q error: %v", key, err)
-			continue
-		}
-		t.Slot = i + 1
-	}
-
-	return tracks
-}
@@ -0,0 +1,10 @@
+package gtask
+
+import (
+	"github.com/quasilyte/ge"
+)
+
+// Init starts the task when it's added to the scene.
+func (task *Task) Init(scene *ge.Scene) {
+	task.Start()
+}
@@ -1,24 +1,39 @@
 package gtask
 
 import (
+	"context"
+	"fmt"
 	"math"
+	"runtime/debug"
 	"sync/atomic"
-	"unsafe"
 
-	"github.com/quasilyte/ge"
 	"github.com/quasilyte/gsignal"
 )
 
+// Task runs a function in a background goroutine.
+//
+// All task events are emitted from the Update method,
+// so the handlers are executed in the game loop goroutine.
 type Task struct {
 	ctx *TaskContext
 
-	f func(ctx *TaskContext)
+	cancel context.CancelFunc
 
-	completed    bool
-	lastProgress float64
+	f func(ctx *TaskContext) error
+
+	started   bool
+	completed bool
+	done      chan error
+
+	lastProgress *TaskProgress
 
 	EventProgress  gsignal.Event[TaskProgress]
 	EventCompleted gsignal.Event[gsignal.Void]
+
+	// EventFailed is emitted instead of EventCompleted
+	// if the task function returns an error or panics.
+	// A cancelled task fails with the context.Canceled error.
+	EventFailed gsignal.Event[error]
 }
 
 type TaskProgress struct {
@@ -27,45 +42,111 @@ type TaskProgress struct {
 }
 
 type TaskContext struct {
-	Progress TaskProgress
+	// Context is cancelled when the task is cancelled.
+	// The long-running tasks should check it periodically.
+	Context context.Context
+
+	progress atomic.Pointer[TaskProgress]
 
-	elapsed float64
+	elapsed atomic.Uint64
 }
 
+// SetProgress reports the current task progress.
+// It's safe to call it from the task goroutine.
+func (ctx *TaskContext) SetProgress(current, total float64) {
+	ctx.progress.Store(&TaskProgress{Current: current, Total: total})
+}
+
+// GetElapsedTime returns the game time passed since the task start.
 func (ctx *TaskContext) GetElapsedTime() float64 {
-	return ctx.elapsed
+	return math.Float64frombits(ctx.elapsed.Load())
+}
+
+// PanicError is a task failure reason if the task function panics.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panic: %v", e.Value)
 }
 
-func StartTask(f func(ctx *TaskContext)) *Task {
+func StartTask(f func(ctx *TaskContext) error) *Task {
+	ctx, cancel := context.WithCancel(context.Background())
 	task := &Task{
-		ctx: &TaskContext{},
-		f:   f,
+		ctx:    &TaskContext{Context: ctx},
+		cancel: cancel,
+		f:      f,
+		done:   make(chan error, 1),
 	}
 	return task
 }
 
-func (task *Task) Init(scene *ge.Scene) {
+// Start runs the task function in a new goroutine.
+// The scene objects don't need to call it, it's called by Init.
+func (task *Task) Start() {
+	if task.started {
+		return
+	}
+	task.started = true
 	go func() {
-		task.f(task.ctx)
-		task.EventCompleted.Emit(gsignal.Void{})
-		task.completed = true
+		task.done <- task.run()
+	}()
+}
+
+func (task *Task) run() (err error) {
+	defer func() {
+		if rv := recover(); rv != nil {
+			err = &PanicError{Value: rv, Stack: debug.Stack()}
+		}
 	}()
+	if err := task.ctx.Context.Err(); err != nil {
+		// Cancelled before it was started.
+		return err
+	}
+	return task.f(task.ctx)
+}
+
+// Cancel requests the task to stop.
+// The task is not stopped immediately: it's up to the task function
+// to check the context and return the error.
+func (task *Task) Cancel() {
+	task.cancel()
 }
 
 func (task *Task) Update(delta float64) {
-	task.ctx.elapsed += delta
+	if task.completed {
+		return
+	}
+	task.ctx.elapsed.Store(math.Float64bits(task.ctx.GetElapsedTime() + delta))
+
+	task.updateProgress()
 
-	progress := atomicLoadFloat64(&task.ctx.Progress.Current)
-	if progress != task.lastProgress {
+	select {
+	case err := <-task.done:
+		task.completed = true
+		task.cancel()
+		if err != nil {
+			task.EventFailed.Emit(err)
+			return
+		}
+		if p := task.lastProgress; p != nil && p.Current != p.Total {
+			task.EventProgress.Emit(TaskProgress{Current: p.Total, Total: p.Total})
+		}
+		task.EventCompleted.Emit(gsignal.Void{})
+	default:
+	}
+}
+
+func (task *Task) updateProgress() {
+	progress := task.ctx.progress.Load()
+	if progress != nil && progress != task.lastProgress {
 		task.lastProgress = progress
-		task.EventProgress.Emit(task.ctx.Progress)
+		task.EventProgress.Emit(*progress)
 	}
 }
 
 func (task *Task) IsDisposed() bool {
 	return task.completed
 }
-
-func atomicLoadFloat64(x *float64) float64 {
-	return math.Float64frombits(atomic.LoadUint64((*uint64)(unsafe.Pointer(x))))
-}
@@ -0,0 +1,132 @@
+package gtask
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/quasilyte/gsignal"
+)
+
+type taskResult struct {
+	completed bool
+	err       error
+	progress  []TaskProgress
+}
+
+// runTask emulates the game loop until the task is disposed.
+func runTask(t *testing.T, task *Task, onUpdate func()) *taskResult {
+	t.Helper()
+
+	result := &taskResult{}
+	task.EventCompleted.Connect(nil, func(gsignal.Void) {
+		result.completed = true
+	})
+	task.EventFailed.Connect(nil, func(err error) {
+		result.err = err
+	})
+	task.EventProgress.Connect(nil, func(p TaskProgress) {
+		result.progress = append(result.progress, p)
+	})
+
+	task.Start()
+	deadline := time.Now().Add(5 * time.Second)
+	for !task.IsDisposed() {
+		if time.Now().After(deadline) {
+			t.Fatal("task is not finished")
+		}
+		if onUpdate != nil {
+			onUpdate()
+		}
+		task.Update(1.0 / 60.0)
+		time.Sleep(time.Millisecond)
+	}
+	return result
+}
+
+func TestTaskCompleted(t *testing.T) {
+	task := StartTask(func(ctx *TaskContext) error {
+		for i := 1; i <= 100; i++ {
+			ctx.SetProgress(float64(i), 200)
+			_ = ctx.GetElapsedTime()
+		}
+		return nil
+	})
+	result := runTask(t, task, nil)
+	if !result.completed || result.err != nil {
+		t.Fatalf("unexpected result: completed=%v err=%v", result.completed, result.err)
+	}
+	last := result.progress[len(result.progress)-1]
+	if last != (TaskProgress{Current: 200, Total: 200}) {
+		t.Fatalf("the last progress is %v", last)
+	}
+}
+
+func TestTaskFailed(t *testing.T) {
+	taskErr := errors.New("test error")
+	task := StartTask(func(ctx *TaskContext) error {
+		ctx.SetProgress(0.5, 1)
+		return taskErr
+	})
+	result := runTask(t, task, nil)
+	if result.completed || result.err != taskErr {
+		t.Fatalf("unexpected result: completed=%v err=%v", result.completed, result.err)
+	}
+}
+
+func TestTaskPanic(t *testing.T) {
+	task := StartTask(func(ctx *TaskContext) error {
+		var m map[string]int
+		m["x"] = 1
+		return nil
+	})
+	result := runTask(t, task, nil)
+	var panicErr *PanicError
+	if !errors.As(result.err, &panicErr) {
+		t.Fatalf("unexpected error: %v", result.err)
+	}
+	if len(panicErr.Stack) == 0 {
+		t.Fatal("panic stack is not captured")
+	}
+}
+
+func TestTaskCancel(t *testing.T) {
+	started := make(chan struct{})
+	task := StartTask(func(ctx *TaskContext) error {
+		close(started)
+		for i := 0; ; i++ {
+			if err := ctx.Context.Err(); err != nil {
+				return err
+			}
+			ctx.SetProgress(float64(i), 0)
+		}
+	})
+	cancelled := false
+	result := runTask(t, task, func() {
+		if !cancelled {
+			<-started
+			task.Cancel()
+			cancelled = true
+		}
+	})
+	if !errors.Is(result.err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", result.err)
+	}
+}
+
+func TestTaskCancelBeforeStart(t *testing.T) {
+	called := false
+	task := StartTask(func(ctx *TaskContext) error {
+		called = true
+		return nil
+	})
+	task.Cancel()
+	result := runTask(t, task, nil)
+	if called {
+		t.Fatal("cancelled task function was called")
+	}
+	if !errors.Is(result.err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", result.err)
+	}
+}
@@ -71,7 +71,7 @@ func (c *LoaderController) Init(scene *ge.Scene) {
 	slotsGridAnchor.AddChild(slotsGrid)
 	rowContainer.AddChild(slotsGridAnchor)
 
-	c.existingTracks = gamedata.DiscoverTracks(scene.Context())
+	c.existingTracks = discoverTracks(scene.Context())
 
 	for i := range c.existingTracks {
 		t := c.existingTracks[i]
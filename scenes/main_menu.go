@@ -75,7 +75,9 @@ func (c *MainMenuController) Init(scene *ge.Scene) {
 
 	initUI(scene, root)
 
-	synthdb.TimGM6mb.Load(assets.SoundFontTimGM6mb)
+	if err := synthdb.TimGM6mb.Load(assets.SoundFontTimGM6mb); err != nil {
+		panic(err)
+	}
 
 	assets.ReadLevelsData()
 }
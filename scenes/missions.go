@@ -64,9 +64,14 @@ func (c *MissionsController) Init(scene *ge.Scene) {
 		buttonsGrid.AddChild(eui.NewCenteredLabel(fmt.Sprintf("%s %d ", d.Get("menu.play.act"), actNumber), normalFont))
 		for i := range levels {
 			l := levels[i]
+			tooltip := "not completed"
+			if c.state.Persistent.GetLevelCompletionStatus(l) >= session.LevelCompleted {
+				tooltip = fmt.Sprintf("best score: %d", c.state.Persistent.GetLevelScore(l))
+			}
 			b := eui.NewButtonWithConfig(c.state.UIResources, eui.ButtonConfig{
 				TextAltColor: c.state.Persistent.GetLevelCompletionStatus(l) >= session.LevelCompleted,
 				Text:         missionLabels[l.MissionNumber],
+				TooltipLabel: tooltip,
 				OnClick: func() {
 					scene.Context().ChangeScene(NewMissionViewController(c.state, l))
 				},
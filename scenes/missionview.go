@@ -11,6 +11,7 @@ import (
 	"github.com/quasilyte/sinecord/eui"
 	"github.com/quasilyte/sinecord/gamedata"
 	"github.com/quasilyte/sinecord/session"
+	"github.com/quasilyte/sinecord/sim"
 	"github.com/quasilyte/sinecord/stage"
 	"github.com/quasilyte/sinecord/styles"
 )
@@ -69,6 +70,7 @@ func (c *MissionViewController) Init(scene *ge.Scene) {
 
 	bonusPanelRows.AddChild(eui.NewCenteredLabel("Bonus conditions", smallFont))
 	bonusPanelRows.AddChild(eui.NewLabel(c.formatBonusRequirements(), monoFont))
+	bonusPanelRows.AddChild(eui.NewLabel(c.formatScore(), monoFont))
 
 	rowContainer.AddChild(eui.NewSeparator(widget.RowLayoutData{Stretch: true}, styles.TransparentColor))
 
@@ -87,6 +89,7 @@ func (c *MissionViewController) Init(scene *ge.Scene) {
 		Data:           c.levelData,
 		MaxInstruments: c.levelData.MaxInstruments,
 		Targets:        c.levelData.Targets,
+		Obstacles:      c.levelData.Obstacles,
 		Mode:           gamedata.MissionMode,
 	}
 
@@ -144,6 +147,13 @@ func (c *MissionViewController) formatBonusRequirements() string {
 	return strings.Join(rules, "\n")
 }
 
+func (c *MissionViewController) formatScore() string {
+	if c.state.Persistent.GetLevelCompletionStatus(c.levelData) == session.LevelNotCompleted {
+		return "Best score: none"
+	}
+	return fmt.Sprintf("Best score: %d/%d", c.state.Persistent.GetLevelScore(c.levelData), sim.MaxScorePoints)
+}
+
 func (c *MissionViewController) panelRowsContainer() *widget.Container {
 	return widget.NewContainer(
 		widget.ContainerOpts.WidgetOpts(widget.WidgetOpts.LayoutData(widget.AnchorLayoutData{
@@ -1,9 +1,16 @@
 package scenes
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image/color"
 	"math"
+	"path/filepath"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ebitenui/ebitenui/widget"
 	"github.com/hajimehoshi/ebiten/v2"
@@ -14,12 +21,15 @@ import (
 	"github.com/quasilyte/gsignal"
 	"github.com/quasilyte/sinecord/assets"
 	"github.com/quasilyte/sinecord/controls"
+	"github.com/quasilyte/sinecord/dsp"
 	"github.com/quasilyte/sinecord/eui"
 	"github.com/quasilyte/sinecord/gamedata"
 	"github.com/quasilyte/sinecord/gtask"
 	"github.com/quasilyte/sinecord/session"
+	"github.com/quasilyte/sinecord/sim"
 	"github.com/quasilyte/sinecord/stage"
 	"github.com/quasilyte/sinecord/styles"
+	"github.com/quasilyte/sinecord/synth"
 	"github.com/quasilyte/sinecord/synthdb"
 )
 
@@ -30,17 +40,25 @@ type StageController struct {
 	config stage.Config
 	track  gamedata.Track
 
-	canvas *stage.Canvas
-	synth  *stage.Synthesizer
-	board  *stage.Board
+	canvas    *stage.Canvas
+	synth     *synth.Synthesizer
+	board     *stage.Board
+	soundFont *synthdb.SoundFont
 
-	prog    stage.SynthProgram
-	samples *stage.SampleSet
-	player  *audio.Player
+	prog   synth.Program
+	stream *synth.SampleStream
+	player *audio.Player
 
 	waveUpdateDelay float64
 	samplesBuf      []float64
 
+	spectrum         *dsp.SpectrumAnalyzer
+	spectrumLevels   []float64
+	spectrumSources  [][]float64
+	spectrumDominant []int
+	spectrumHeights  []float64
+	spectrumColors   []color.RGBA
+
 	instrumentIcons []*ebiten.Image
 
 	canvasWidget  *widget.Graphic
@@ -56,20 +74,43 @@ type StageController struct {
 
 	completed    bool
 	bonusReached bool
+	bonusFailure string
+	score        sim.Score
+	exportTask   *gtask.Task
+
+	// seekTask renders the stream up to the seek position,
+	// the playback is paused until it's completed.
+	seekTask *gtask.Task
+
+	// loopStart is where the playback starts.
+	// If loopEnd is greater than loopStart, the [loopStart, loopEnd)
+	// region is played repeatedly.
+	loopStart float64
+	loopEnd   float64
+
+	// speed is the current stream playback speed.
+	speed float64
+
+	// limiterReduction is the max limiter gain reduction
+	// reported in the status while playing.
+	limiterReduction float64
 }
 
+// seekDistance is a seek step of the keyboard controls.
+const seekDistance = 2.0 // seconds
+
 type stageMode int
 
 const (
 	stageReady stageMode = iota
 	stagePlaying
-	stageEncoding
 )
 
 func NewStageController(state *session.State, config stage.Config) *StageController {
 	c := &StageController{
 		state:  state,
 		config: config,
+		speed:  1,
 	}
 	if !config.Track.IsEmpty() {
 		c.track = config.Track
@@ -88,6 +129,56 @@ func (c *StageController) setInstrumentPeriod(id int, s string) {
 	}
 }
 
+func (c *StageController) setInstrumentGate(id int, s string) {
+	err := c.synth.SetInstrumentGate(id, strings.ToLower(s))
+	if err != nil {
+		fmt.Printf("compile gate: %v\n", err)
+	}
+}
+
+func (c *StageController) setInstrumentPan(id int, s string) {
+	err := c.synth.SetInstrumentPan(id, strings.ToLower(s))
+	if err != nil {
+		fmt.Printf("compile pan: %v\n", err)
+	}
+}
+
+// effectSendLevels are the reverb and chorus send presets.
+var effectSendLevels = []float64{0, 0.25, 0.5, 0.75, 1}
+
+// newEffectSendSelect creates a reverb or chorus send level select.
+// A loaded send level that is not one of the presets is kept as an extra value.
+// The send level is expected to be already applied.
+func (c *StageController) newEffectSendSelect(label string, send float64, tooltip string, apply func(send float64)) *widget.Button {
+	levels := effectSendLevels
+	index := xslices.Index(levels, send)
+	if index == -1 {
+		levels = append(append([]float64{}, levels...), send)
+		index = len(levels) - 1
+	}
+	names := make([]string, len(levels))
+	for i, level := range levels {
+		names[i] = fmt.Sprintf("%s %d%%", label, int(math.Round(level*100)))
+	}
+	return eui.NewSelectButton(eui.SelectButtonConfig{
+		Resources:  c.state.UIResources,
+		Input:      c.state.Input,
+		ValueNames: names,
+		Value:      &index,
+		MinWidth:   120,
+		Tooltip:    eui.NewTooltip(c.state.UIResources, tooltip),
+		OnPressed: func() {
+			apply(levels[index])
+		},
+	})
+}
+
+func (c *StageController) setTempo(tempo synthdb.Tempo) {
+	if err := c.synth.SetTempo(tempo); err != nil {
+		fmt.Printf("set tempo: %v\n", err)
+	}
+}
+
 func (c *StageController) Init(scene *ge.Scene) {
 	c.scene = scene
 
@@ -111,12 +202,26 @@ func (c *StageController) Init(scene *ge.Scene) {
 
 	smallFont := scene.Context().Loader.LoadFont(assets.FontArcadeSmall).Face
 
-	c.synth = stage.NewSynthesizer(ctx, synthdb.TimGM6mb)
-	scene.AddObject(c.synth)
+	// The user fonts are only available in the sandbox mode.
+	c.soundFont = synthdb.TimGM6mb
+	if c.config.Mode == gamedata.SandboxMode {
+		c.soundFont = synthdb.FindSoundFont(c.track.SoundFont)
+	}
+
+	c.synth = synth.NewSynthesizer(synth.Config{
+		MaxInstruments: c.config.MaxInstruments,
+		Rand:           scene.Rand(),
+	}, c.soundFont)
+	// An unknown scale falls back to the chromatic one.
+	if err := c.synth.ApplyTrack(c.track); err != nil {
+		fmt.Printf("load track: %v\n", err)
+	}
+	c.synth.SetMuteZones(gamedata.MuteZones(c.config.Obstacles, c.state.PlotScaler))
 
 	c.board = stage.NewBoard(ctx, stage.BoardConfig{
 		Canvas:         c.canvas,
 		Targets:        c.config.Targets,
+		Obstacles:      c.config.Obstacles,
 		MaxInstruments: c.config.MaxInstruments,
 		Level:          c.config.Data,
 	})
@@ -130,9 +235,11 @@ func (c *StageController) Init(scene *ge.Scene) {
 		// c.canvas.WaveColor.G *= (float32(clr.G) / 255.0) + 1
 		// c.canvas.WaveColor.B *= (float32(clr.B) / 255.0) + 1
 	})
-	c.board.EventVictory.Connect(c, func(bonus bool) {
+	c.board.EventVictory.Connect(c, func(result sim.Result) {
 		c.completed = true
-		c.bonusReached = bonus
+		c.bonusReached = result.Bonus
+		c.bonusFailure = result.BonusFailure
+		c.score = result.Score
 		c.updateExitText()
 	})
 
@@ -170,8 +277,8 @@ func (c *StageController) Init(scene *ge.Scene) {
 
 	instrumentsGrid := widget.NewContainer(
 		widget.ContainerOpts.Layout(widget.NewGridLayout(
-			widget.GridLayoutOpts.Columns(6),
-			widget.GridLayoutOpts.Stretch([]bool{false, false, false, true, false, false, false}, nil),
+			widget.GridLayoutOpts.Columns(13),
+			widget.GridLayoutOpts.Stretch([]bool{false, false, false, false, false, false, false, false, false, false, true, false, false}, nil),
 			widget.GridLayoutOpts.Spacing(4, 8),
 		)))
 	outerGrid.AddChild(instrumentsGrid)
@@ -180,8 +287,8 @@ func (c *StageController) Init(scene *ge.Scene) {
 	patchIndexToInstument := map[int]int{}
 	if c.config.Mode == gamedata.SandboxMode {
 		// All instruments are available.
-		patchNames = make([]string, len(synthdb.TimGM6mb.Instruments))
-		for i, inst := range synthdb.TimGM6mb.Instruments {
+		patchNames = make([]string, len(c.soundFont.Instruments))
+		for i, inst := range c.soundFont.Instruments {
 			patchNames[i] = inst.Name
 			patchIndexToInstument[i] = i
 		}
@@ -190,7 +297,7 @@ func (c *StageController) Init(scene *ge.Scene) {
 		for _, t := range c.config.Targets {
 			usedInstruments[t.Instrument] = struct{}{}
 		}
-		for i, inst := range synthdb.TimGM6mb.Instruments {
+		for i, inst := range c.soundFont.Instruments {
 			if _, ok := usedInstruments[inst.Kind]; !ok {
 				continue
 			}
@@ -232,6 +339,12 @@ func (c *StageController) Init(scene *ge.Scene) {
 	for i := range periods {
 		periodLabels[i] = fmt.Sprintf("%.2f", periods[i])
 	}
+	// Only one instrument can use a drum kit.
+	isPatchDisabled := func(instrumentID, i int) bool {
+		inst := c.soundFont.Instruments[patchIndexToInstument[i]]
+		other := c.synth.PercussionInstrument()
+		return inst.IsPercussion() && other != -1 && other != instrumentID
+	}
 	defaultPeriods := []string{
 		"pi/8",
 		"pi/6",
@@ -243,14 +356,32 @@ func (c *StageController) Init(scene *ge.Scene) {
 	for i := 0; i < c.config.MaxInstruments; i++ {
 		instrumentID := i
 
-		var loadedInstrument *gamedata.InstrumentSettings
+		// The synthesizer is configured the same way as LoadTrack does it,
+		// then the widgets are initialized from the applied settings.
+		settings := gamedata.InstrumentSettings{
+			PeriodFunction: defaultPeriods[instrumentID],
+			Volume:         1.0,
+			Enabled:        true,
+		}
 		if !c.track.IsEmpty() && len(c.track.Instruments) > instrumentID {
 			if c.track.Instruments[instrumentID].Function != "" {
-				loadedInstrument = &c.track.Instruments[instrumentID]
+				settings = c.track.Instruments[instrumentID]
+			}
+		}
+		patchIndex := xslices.Index(patchNames, settings.InstrumentName)
+		if patchIndex == -1 || isPatchDisabled(instrumentID, patchIndex) {
+			// The first available instrument is used instead.
+			patchIndex = 0
+			for patchIndex < len(patchNames)-1 && isPatchDisabled(instrumentID, patchIndex) {
+				patchIndex++
 			}
+			settings.InstrumentName = patchNames[patchIndex]
 		}
+		if err := c.synth.ApplyInstrument(instrumentID, settings); err != nil {
+			fmt.Printf("load track: %v\n", err)
+		}
+		c.drawInstrumentIcon(instrumentID, patchIndexToInstument[patchIndex])
 
-		c.canvas.DrawInstrumentIcon(c.instrumentIcons[instrumentID], gamedata.BassInstrument, styles.PlotColorByID[instrumentID])
 		var plotToggle eui.ImageButton
 		plotToggle = eui.NewImageButton(c.state.UIResources, c.instrumentIcons[instrumentID], eui.ButtonConfig{
 			OnClick: func() {
@@ -267,7 +398,7 @@ func (c *StageController) Init(scene *ge.Scene) {
 		instrumentsGrid.AddChild(plotToggle.Widget)
 
 		formulaInput := eui.NewFunctionInput(c.state.UIResources, eui.FunctionInputConfig{
-			MinWidth:      880,
+			MinWidth:      340,
 			TooltipLabel:  "f(x)",
 			MaxTextLength: 60,
 			OnChange: func(s string) {
@@ -276,13 +407,10 @@ func (c *StageController) Init(scene *ge.Scene) {
 		})
 		c.inputWidgets = append(c.inputWidgets, formulaInput)
 		instrumentsGrid.AddChild(formulaInput)
-		if loadedInstrument != nil {
-			formulaInput.InputText = loadedInstrument.Function
-			c.setInstrumentFunction(instrumentID, loadedInstrument.Function)
-		}
+		formulaInput.InputText = settings.Function
 
 		periodInput := eui.NewFunctionInput(c.state.UIResources, eui.FunctionInputConfig{
-			MinWidth:      210,
+			MinWidth:      160,
 			TooltipLabel:  d.Get("stage.period.tooltip"),
 			MaxTextLength: 12,
 			OnChange: func(s string) {
@@ -290,59 +418,139 @@ func (c *StageController) Init(scene *ge.Scene) {
 			},
 		})
 		c.inputWidgets = append(c.inputWidgets, periodInput)
-		if loadedInstrument != nil {
-			periodInput.InputText = loadedInstrument.PeriodFunction
-			c.setInstrumentPeriod(instrumentID, loadedInstrument.PeriodFunction)
-		} else {
-			periodInput.InputText = defaultPeriods[instrumentID]
-			c.setInstrumentPeriod(instrumentID, periodInput.InputText)
-		}
+		periodInput.InputText = settings.PeriodFunction
 		instrumentsGrid.AddChild(periodInput)
 
-		patchIndex := 0
-		if loadedInstrument != nil {
-			instrumentIndex := xslices.IndexWhere(synthdb.TimGM6mb.Instruments, func(inst *synthdb.Instrument) bool {
-				return inst.Name == loadedInstrument.InstrumentName
-			})
-			for k, i := range patchIndexToInstument {
-				if instrumentIndex == i {
-					patchIndex = k
-					break
+		gateInput := eui.NewFunctionInput(c.state.UIResources, eui.FunctionInputConfig{
+			MinWidth:      120,
+			TooltipLabel:  d.Get("stage.gate.tooltip"),
+			MaxTextLength: 12,
+			OnChange: func(s string) {
+				c.setInstrumentGate(instrumentID, s)
+			},
+		})
+		c.inputWidgets = append(c.inputWidgets, gateInput)
+		gateInput.InputText = settings.GateFunction
+		instrumentsGrid.AddChild(gateInput)
+
+		panInput := eui.NewFunctionInput(c.state.UIResources, eui.FunctionInputConfig{
+			MinWidth:      120,
+			TooltipLabel:  d.Get("stage.pan.tooltip"),
+			MaxTextLength: 12,
+			OnChange: func(s string) {
+				c.setInstrumentPan(instrumentID, s)
+			},
+		})
+		c.inputWidgets = append(c.inputWidgets, panInput)
+		panInput.InputText = settings.PanFunction
+		instrumentsGrid.AddChild(panInput)
+
+		// The custom chord input overrides the selected chord shape.
+		// The custom shape is never selected, it's implied by the input.
+		chordShape := int(synthdb.SingleNote)
+		customChord := ""
+		if chord, ok := synthdb.ParseChord(settings.Chord); ok && chord.Shape != synthdb.CustomChord {
+			chordShape = int(chord.Shape)
+		} else {
+			customChord = settings.Chord
+		}
+		onChordChanged := func() {
+			src := strings.TrimSpace(customChord)
+			if src == "" {
+				if shape := synthdb.ChordShape(chordShape); shape != synthdb.SingleNote {
+					src = shape.String()
 				}
 			}
+			if err := c.synth.SetInstrumentChord(instrumentID, strings.ToLower(src)); err != nil {
+				fmt.Printf("compile chord: %v\n", err)
+			}
+		}
+		instrumentsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+			Resources:      c.state.UIResources,
+			Input:          c.state.Input,
+			ValueNames:     synthdb.ChordShapeNames,
+			DisabledValues: []int{int(synthdb.CustomChord)},
+			Value:          &chordShape,
+			MinWidth:       120,
+			Tooltip:        eui.NewTooltip(c.state.UIResources, "chord: every note is played as a chord snapped to the scale"),
+			OnPressed:      onChordChanged,
+		}))
+		chordInput := eui.NewFunctionInput(c.state.UIResources, eui.FunctionInputConfig{
+			MinWidth:      120,
+			TooltipLabel:  d.Get("stage.chord.tooltip"),
+			MaxTextLength: 24,
+			OnChange: func(s string) {
+				customChord = s
+				onChordChanged()
+			},
+		})
+		chordInput.InputText = customChord
+		c.inputWidgets = append(c.inputWidgets, chordInput)
+		instrumentsGrid.AddChild(chordInput)
+
+		glideRanges := []int{0, 2, 12, synth.MaxGlideRange}
+		glideNames := []string{"steps", "glide 2", "glide 12", fmt.Sprintf("glide %d", synth.MaxGlideRange)}
+		glideIndex := xslices.Index(glideRanges, settings.Glide)
+		if glideIndex == -1 {
+			glideIndex = len(glideRanges)
+			glideRanges = append(glideRanges, settings.Glide)
+			glideNames = append(glideNames, fmt.Sprintf("glide %d", settings.Glide))
 		}
-		c.selectInstrument(instrumentID, patchIndexToInstument[patchIndex])
+		instrumentsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+			Resources:  c.state.UIResources,
+			Input:      c.state.Input,
+			ValueNames: glideNames,
+			Value:      &glideIndex,
+			MinWidth:   120,
+			Tooltip:    eui.NewTooltip(c.state.UIResources, "glide: the note pitch follows f(x) smoothly within the pitch bend range (semitones)"),
+			OnPressed: func() {
+				c.synth.SetInstrumentGlide(instrumentID, glideRanges[glideIndex])
+			},
+		}))
+
+		instrumentsGrid.AddChild(c.newEffectSendSelect("rev", settings.ReverbSend, "reverb send level", func(send float64) {
+			c.synth.SetInstrumentReverb(instrumentID, send)
+		}))
+		instrumentsGrid.AddChild(c.newEffectSendSelect("cho", settings.ChorusSend, "chorus send level", func(send float64) {
+			c.synth.SetInstrumentChorus(instrumentID, send)
+		}))
+
 		instrumentsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
 			Resources:  c.state.UIResources,
 			Input:      c.state.Input,
 			ValueNames: patchNames,
 			Value:      &patchIndex,
-			MinWidth:   320,
-			Tooltip:    eui.NewTooltip(c.state.UIResources, "instrument style"),
+			MinWidth:   210,
+			IsDisabled: func(i int) bool {
+				return isPatchDisabled(instrumentID, i)
+			},
+			Tooltip: eui.NewTooltip(c.state.UIResources, "instrument style"),
 			OnPressed: func() {
 				c.selectInstrument(instrumentID, patchIndexToInstument[patchIndex])
 			},
 		}))
 
-		volumeLevel := 4
-		if loadedInstrument != nil {
-			volumeLevel = xslices.Index(volumeLevels, loadedInstrument.Volume)
+		levels := volumeLevels
+		volumeNames := []string{"20%", "40%", "60%", "80%", "100%"}
+		volumeLevel := xslices.Index(levels, settings.Volume)
+		if volumeLevel == -1 {
+			volumeLevel = len(levels)
+			levels = append(append([]float64{}, levels...), settings.Volume)
+			volumeNames = append(volumeNames, fmt.Sprintf("%d%%", int(math.Round(settings.Volume*100))))
 		}
-		c.synth.SetInstrumentVolume(instrumentID, volumeLevels[volumeLevel])
 		instrumentsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
 			Resources:  c.state.UIResources,
 			Input:      c.state.Input,
-			ValueNames: []string{"20%", "40%", "60%", "80%", "100%"},
+			ValueNames: volumeNames,
 			MinWidth:   120,
 			Value:      &volumeLevel,
 			Tooltip:    eui.NewTooltip(c.state.UIResources, "instrument volume level"),
 			OnPressed: func() {
-				c.synth.SetInstrumentVolume(instrumentID, volumeLevels[volumeLevel])
+				c.synth.SetInstrumentVolume(instrumentID, levels[volumeLevel])
 			},
 		}))
 
-		instrumentEnabled := loadedInstrument == nil || loadedInstrument.Enabled
-		c.synth.SetInstrumentEnabled(instrumentID, instrumentEnabled)
+		instrumentEnabled := settings.Enabled
 		instrumentsGrid.AddChild(eui.NewBoolSelectButton(eui.BoolSelectButtonConfig{
 			Resources:  c.state.UIResources,
 			ValueNames: []string{"off", "on"},
@@ -397,13 +605,15 @@ func (c *StageController) Init(scene *ge.Scene) {
 				widget.GridLayoutOpts.Spacing(4, 8),
 			)))
 
+		// The controls go in pairs, like run/stop and bpm/signature,
+		// so the column fits the canvas panel height.
 		buttonsGrid := widget.NewContainer(
 			widget.ContainerOpts.WidgetOpts(
-				widget.WidgetOpts.MinSize(256, 0),
+				widget.WidgetOpts.MinSize(360, 0),
 			),
 			widget.ContainerOpts.Layout(widget.NewGridLayout(
-				widget.GridLayoutOpts.Columns(1),
-				widget.GridLayoutOpts.Stretch([]bool{true}, nil),
+				widget.GridLayoutOpts.Columns(2),
+				widget.GridLayoutOpts.Stretch([]bool{true, true}, nil),
 				widget.GridLayoutOpts.Padding(widget.NewInsetsSimple(8)),
 				widget.GridLayoutOpts.Spacing(4, 8),
 			)))
@@ -415,6 +625,19 @@ func (c *StageController) Init(scene *ge.Scene) {
 		})
 		buttonsGrid.AddChild(stopButton)
 
+		c.createPlaybackControls(buttonsGrid)
+
+		buttonsGrid.AddChild(eui.NewBoolSelectButton(eui.BoolSelectButtonConfig{
+			Resources:  c.state.UIResources,
+			ValueNames: []string{"wave", "spectrum"},
+			Value:      &c.state.Persistent.SpectrumView,
+			Tooltip:    eui.NewTooltip(c.state.UIResources, "playback visualization: an oscilloscope or a spectrum analyzer"),
+			OnPressed: func() {
+				c.canvas.Reset()
+				c.scene.Context().SaveGameData("save", c.state.Persistent)
+			},
+		}))
+
 		if c.config.Mode == gamedata.MissionMode {
 			helpButton := eui.NewButton(c.state.UIResources, "help", func() {
 				back := NewStageController(c.state, c.config)
@@ -442,6 +665,114 @@ func (c *StageController) Init(scene *ge.Scene) {
 				c.changeScene(loader)
 			})
 			buttonsGrid.AddChild(loadButton)
+
+			if len(synthdb.SoundFonts) > 1 {
+				fontNames := make([]string, len(synthdb.SoundFonts))
+				fontIndex := 0
+				for i, sf := range synthdb.SoundFonts {
+					fontNames[i] = sf.Name
+					if sf == c.soundFont {
+						fontIndex = i
+					}
+				}
+				buttonsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+					Resources:  c.state.UIResources,
+					Input:      c.state.Input,
+					ValueNames: fontNames,
+					Value:      &fontIndex,
+					Tooltip:    eui.NewTooltip(c.state.UIResources, "sound font"),
+					OnPressed: func() {
+						// The instruments list depends on the font,
+						// so the stage is re-created.
+						back := NewStageController(c.state, c.config)
+						back.track = c.synth.ExportTrack()
+						back.track.SoundFont = synthdb.SoundFonts[fontIndex].Name
+						c.changeScene(back)
+					},
+				}))
+			}
+
+			// There is no file system to export the files to in the browser.
+			if runtime.GOOS != "js" {
+				exportButton := eui.NewButton(c.state.UIResources, "export", c.onExportPressed)
+				buttonsGrid.AddChild(exportButton)
+			}
+			// Keep the following pairs aligned.
+			if len(buttonsGrid.Children())%2 != 0 {
+				buttonsGrid.AddChild(widget.NewContainer())
+			}
+
+			scale := c.synth.GetScale()
+			scaleRoot := scale.Root
+			scaleMode := int(scale.Mode)
+			onScaleChanged := func() {
+				c.synth.SetScale(synthdb.Scale{
+					Root: scaleRoot,
+					Mode: synthdb.ScaleMode(scaleMode),
+				})
+			}
+			buttonsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+				Resources:  c.state.UIResources,
+				Input:      c.state.Input,
+				ValueNames: synthdb.ScaleRootNames,
+				Value:      &scaleRoot,
+				Label:      "root",
+				Tooltip:    eui.NewTooltip(c.state.UIResources, "scale root note"),
+				OnPressed:  onScaleChanged,
+			}))
+			buttonsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+				Resources:  c.state.UIResources,
+				Input:      c.state.Input,
+				ValueNames: synthdb.ScaleModeNames,
+				Value:      &scaleMode,
+				Tooltip:    eui.NewTooltip(c.state.UIResources, "scale mode: every note is snapped to the nearest scale degree"),
+				OnPressed:  onScaleChanged,
+			}))
+
+			tempo := c.synth.GetTempo()
+			bpmValues := []float64{60, 70, 80, 90, 100, 110, 120, 130, 140, 150, 160, 180}
+			bpmIndex := xslices.Index(bpmValues, tempo.BPM)
+			if bpmIndex == -1 {
+				// A custom value from the track file.
+				bpmIndex = len(bpmValues)
+				bpmValues = append(bpmValues, tempo.BPM)
+			}
+			bpmNames := make([]string, len(bpmValues))
+			for i, bpm := range bpmValues {
+				bpmNames[i] = strconv.FormatFloat(bpm, 'f', -1, 64)
+			}
+			signatureIndex := xslices.Index(synthdb.TimeSignatureNames, tempo.Signature())
+			if signatureIndex == -1 {
+				signatureIndex = 0
+			}
+			snapToGrid := tempo.SnapToGrid
+			onTempoChanged := func() {
+				c.setTempo(synthdb.ParseTempo(bpmValues[bpmIndex], synthdb.TimeSignatureNames[signatureIndex], snapToGrid))
+			}
+			buttonsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+				Resources:  c.state.UIResources,
+				Input:      c.state.Input,
+				ValueNames: bpmNames,
+				Value:      &bpmIndex,
+				Label:      "bpm",
+				Tooltip:    eui.NewTooltip(c.state.UIResources, "tempo: affects the beat, bar and 16th period units"),
+				OnPressed:  onTempoChanged,
+			}))
+			buttonsGrid.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+				Resources:  c.state.UIResources,
+				Input:      c.state.Input,
+				ValueNames: synthdb.TimeSignatureNames,
+				Value:      &signatureIndex,
+				Tooltip:    eui.NewTooltip(c.state.UIResources, "time signature"),
+				OnPressed:  onTempoChanged,
+			}))
+			buttonsGrid.AddChild(eui.NewBoolSelectButton(eui.BoolSelectButtonConfig{
+				Resources:  c.state.UIResources,
+				ValueNames: []string{"free", "grid"},
+				Value:      &snapToGrid,
+				Tooltip:    eui.NewTooltip(c.state.UIResources, "snap the notes to the 16th notes grid"),
+				OnPressed:  onTempoChanged,
+			}))
 		}
 
 		exitButton := eui.NewButton(c.state.UIResources, "exit", func() {
@@ -476,9 +807,67 @@ func (c *StageController) Init(scene *ge.Scene) {
 	scene.AddGraphics(c)
 }
 
+// createPlaybackControls adds the practice playback buttons:
+// the start time, the loop end and the speed.
+func (c *StageController) createPlaybackControls(container *widget.Container) {
+	length := int(c.synth.CreateProgram(-1).Length)
+
+	// The time values are in whole seconds.
+	startNames := make([]string, length)
+	for i := range startNames {
+		startNames[i] = fmt.Sprintf("%ds", i)
+	}
+	endNames := make([]string, length+1)
+	endNames[0] = "off"
+	for i := 1; i < len(endNames); i++ {
+		endNames[i] = fmt.Sprintf("%ds", i)
+	}
+	startIndex := 0
+	endIndex := 0
+	container.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+		Resources:  c.state.UIResources,
+		Input:      c.state.Input,
+		ValueNames: startNames,
+		Value:      &startIndex,
+		Label:      "from",
+		Tooltip:    eui.NewTooltip(c.state.UIResources, "playback start time; the arrow keys seek during the playback"),
+		OnPressed: func() {
+			c.loopStart = float64(startIndex)
+			if c.currentMode == stagePlaying {
+				c.seekTo(c.loopStart)
+			}
+		},
+	}))
+	container.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+		Resources:  c.state.UIResources,
+		Input:      c.state.Input,
+		ValueNames: endNames,
+		Value:      &endIndex,
+		Label:      "loop",
+		Tooltip:    eui.NewTooltip(c.state.UIResources, "loop end time: the playback jumps back to the start time when it's reached"),
+		OnPressed: func() {
+			c.loopEnd = float64(endIndex)
+		},
+	}))
+
+	speeds := []float64{1, 0.5, 0.25}
+	speedIndex := xslices.Index(speeds, c.synth.GetPlaybackSpeed())
+	container.AddChild(eui.NewSelectButton(eui.SelectButtonConfig{
+		Resources:  c.state.UIResources,
+		Input:      c.state.Input,
+		ValueNames: []string{"100%", "50%", "25%"},
+		Value:      &speedIndex,
+		Label:      "speed",
+		Tooltip:    eui.NewTooltip(c.state.UIResources, "practice playback speed, applied on the next run"),
+		OnPressed: func() {
+			c.synth.SetPlaybackSpeed(speeds[speedIndex])
+		},
+	}))
+}
+
 func (c *StageController) onDoneOrExit() {
 	if c.completed {
-		c.state.Persistent.UpdateLevelCompletion(c.config.Data, c.bonusReached)
+		c.state.Persistent.UpdateLevelCompletion(c.config.Data, c.bonusReached, c.score.Points)
 		c.scene.Context().SaveGameData("save", c.state.Persistent)
 	}
 
@@ -492,9 +881,16 @@ func (c *StageController) onDoneOrExit() {
 	}
 }
 
-func (c *StageController) selectInstrument(instrumentID int, patchIndex int) {
-	c.synth.SetInstrumentPatch(instrumentID, patchIndex)
-	kind := synthdb.TimGM6mb.Instruments[patchIndex].Kind
+func (c *StageController) selectInstrument(instrumentID int, patchIndex int) error {
+	if err := c.synth.SetInstrumentPatch(instrumentID, patchIndex); err != nil {
+		return err
+	}
+	c.drawInstrumentIcon(instrumentID, patchIndex)
+	return nil
+}
+
+func (c *StageController) drawInstrumentIcon(instrumentID int, patchIndex int) {
+	kind := c.soundFont.Instruments[patchIndex].Kind
 	c.instrumentIcons[instrumentID].Clear()
 	c.canvas.DrawInstrumentIcon(c.instrumentIcons[instrumentID], kind, styles.PlotColorByID[instrumentID])
 }
@@ -506,19 +902,22 @@ func (c *StageController) Draw(*ebiten.Image) {
 }
 
 func (c *StageController) Update(delta float64) {
+	c.synth.Update(delta)
+
 	if c.state.Input.ActionIsJustPressed(controls.ActionBack) {
 		c.onDoneOrExit()
 		return
 	}
-	if c.state.Input.ActionIsJustPressed(controls.ActionTogglePlay) {
-		canToggle := true
-		for _, w := range c.inputWidgets {
-			if w.IsFocused() {
-				canToggle = false
-				break
-			}
+	// The keys are handled by the focused text input.
+	inputFocused := false
+	for _, w := range c.inputWidgets {
+		if w.IsFocused() {
+			inputFocused = true
+			break
 		}
-		if canToggle {
+	}
+	if !inputFocused {
+		if c.state.Input.ActionIsJustPressed(controls.ActionTogglePlay) {
 			switch c.currentMode {
 			case stagePlaying:
 				c.onStopPressed()
@@ -526,6 +925,14 @@ func (c *StageController) Update(delta float64) {
 				c.onPlayPressed()
 			}
 		}
+		if c.currentMode == stagePlaying {
+			if c.state.Input.ActionIsJustPressed(controls.ActionSeekBackward) {
+				c.seekTo(c.board.Time() - seekDistance)
+			}
+			if c.state.Input.ActionIsJustPressed(controls.ActionSeekForward) {
+				c.seekTo(c.board.Time() + seekDistance)
+			}
+		}
 	}
 
 	c.canvas.Running = c.currentMode == stagePlaying
@@ -540,27 +947,115 @@ func (c *StageController) Update(delta float64) {
 				waveColor = styles.VictorySoundWaveColor
 				waveWidth = 4.0
 			}
-			c.canvas.RenderWave(waveColor, waveWidth, c.waveSamples())
+			if c.state.Persistent.SpectrumView {
+				c.renderSpectrum(waveColor)
+			} else {
+				c.canvas.RenderWave(waveColor, waveWidth, c.waveSamples())
+			}
+		}
+
+		if reduction := c.stream.LimiterStats().MaxReduction; reduction != c.limiterReduction {
+			c.limiterReduction = reduction
+			c.updateStatusText()
 		}
 
-		if c.board.ProgramTick(delta) {
-			c.board.ClearProgram()
-			c.setMode(stageReady)
+		// The board waits for the audio while it's seeking.
+		if c.seekTask == nil {
+			finished := c.board.ProgramTick(c.boardDelta(delta))
+			if c.loopEnd > c.loopStart && c.board.Time() >= c.loopEnd {
+				c.seekTo(c.loopStart)
+			} else if finished {
+				c.board.ClearProgram()
+				c.setMode(stageReady)
+			}
 		}
 	}
 
 	c.canvas.Update(delta)
 }
 
+// boardDelta returns the board time step that keeps it in sync with the audio.
+// The audio time runs slower than the board time at the practice speeds.
+func (c *StageController) boardDelta(delta float64) float64 {
+	if !c.player.IsPlaying() {
+		return delta * c.speed
+	}
+	return gmath.ClampMin(c.player.Current().Seconds()*c.speed-c.board.Time(), 0)
+}
+
+// seekTo moves the playback to the program time t.
+// The board is re-simulated from the program start.
+//
+// The player seek mixes all skipped samples, so the instruments
+// are synthesized up to t by a background task first.
+// The audio is paused until the task is completed.
+func (c *StageController) seekTo(t float64) {
+	c.cancelSeek()
+	if c.board.SeekProgram(c.prog, gmath.Clamp(t, 0, c.prog.Length)) {
+		c.onStopPressed()
+		return
+	}
+	c.canvas.Reset()
+
+	// The stream time runs slower than the program time at the practice speeds.
+	streamTime := c.board.Time() / c.speed
+	pos := int(streamTime * float64(c.stream.SampleRate()))
+	if c.stream.IsPrerendered(pos) {
+		c.seekPlayer(streamTime)
+		return
+	}
+
+	c.player.Pause()
+	stream := c.stream
+	seekTask := gtask.StartTask(func(ctx *gtask.TaskContext) error {
+		return stream.Prerender(ctx.Context, pos)
+	})
+	// A cancelled task can still complete, so the stale events are ignored.
+	seekTask.EventFailed.Connect(nil, func(err error) {
+		if c.seekTask != seekTask {
+			return
+		}
+		fmt.Printf("prerender audio: %v\n", err)
+		c.seekTask = nil
+		c.onStopPressed()
+	})
+	seekTask.EventCompleted.Connect(nil, func(gsignal.Void) {
+		if c.seekTask != seekTask {
+			return
+		}
+		c.seekTask = nil
+		c.seekPlayer(streamTime)
+		c.player.Play()
+	})
+	c.seekTask = seekTask
+	c.scene.AddObject(seekTask)
+}
+
+func (c *StageController) seekPlayer(streamTime float64) {
+	if err := c.player.Seek(time.Duration(streamTime * float64(time.Second))); err != nil {
+		fmt.Printf("seek audio player: %v\n", err)
+	}
+}
+
+// cancelSeek stops the pending seek, its task events are ignored.
+func (c *StageController) cancelSeek() {
+	if c.seekTask == nil {
+		return
+	}
+	c.seekTask.Cancel()
+	c.seekTask = nil
+}
+
 func (c *StageController) waveSamples() []float64 {
 	c.samplesBuf = c.samplesBuf[:0]
 
-	sampleRate := float64(c.samples.PerSecond)
-	numSamples := len(c.samples.Left)
+	samples := c.stream.Samples()
+	sampleRate := float64(samples.PerSecond)
+	numSamples := c.stream.Pos()
 
 	currentSecond := c.player.Current().Seconds()
 	currentSample := int(math.Round(currentSecond * sampleRate))
-	samplesPerHalf := c.samples.PerSecond / 60
+	samplesPerHalf := samples.PerSecond / 60
 
 	fromSample := currentSample - samplesPerHalf
 	toSample := currentSample + samplesPerHalf
@@ -570,17 +1065,78 @@ func (c *StageController) waveSamples() []float64 {
 	}
 
 	for i := fromSample; i < toSample; i++ {
-		v := float64(c.samples.Left[i] + c.samples.Right[i])
+		v := float64(samples.Left[i] + samples.Right[i])
 		c.samplesBuf = append(c.samplesBuf, v)
 	}
 
 	return c.samplesBuf
 }
 
+// renderSpectrum draws the spectrum of the samples around the playhead.
+// Every band is colored by the instrument that dominates it.
+func (c *StageController) renderSpectrum(defaultColor color.RGBA) {
+	const (
+		blockSize = 2048
+		numBands  = 48
+
+		// The levels below this are not displayed.
+		minLevelDB = -60.0
+	)
+
+	samples := c.stream.Samples()
+	if c.spectrum == nil {
+		c.spectrum = dsp.NewSpectrumAnalyzer(dsp.SpectrumConfig{
+			SampleRate: samples.PerSecond,
+			Size:       blockSize,
+			NumBands:   numBands,
+			MinFreq:    40,
+			MaxFreq:    16000,
+		})
+		c.spectrumSources = make([][]float64, c.config.MaxInstruments)
+	}
+
+	currentSample := int(math.Round(c.player.Current().Seconds() * float64(samples.PerSecond)))
+	fromSample := currentSample - blockSize/2
+	toSample := fromSample + blockSize
+	if fromSample < 0 || toSample >= c.stream.Pos() {
+		c.canvas.RenderSpectrum(nil, nil)
+		return
+	}
+
+	c.samplesBuf = c.samplesBuf[:0]
+	for i := fromSample; i < toSample; i++ {
+		c.samplesBuf = append(c.samplesBuf, float64(samples.Left[i]+samples.Right[i]))
+	}
+	c.spectrumLevels = c.spectrum.Bands(c.spectrumLevels[:0], c.samplesBuf)
+
+	for id := range c.spectrumSources {
+		c.spectrumSources[id] = c.spectrumSources[id][:0]
+		c.samplesBuf = c.stream.InstrumentSamples(c.samplesBuf[:0], id, fromSample, toSample)
+		if len(c.samplesBuf) != 0 {
+			c.spectrumSources[id] = c.spectrum.Bands(c.spectrumSources[id], c.samplesBuf)
+		}
+	}
+	c.spectrumDominant = dsp.Dominant(c.spectrumDominant[:0], c.spectrumSources, numBands)
+
+	c.spectrumHeights = c.spectrumHeights[:0]
+	c.spectrumColors = c.spectrumColors[:0]
+	for i, level := range c.spectrumLevels {
+		db := 20 * math.Log10(level)
+		c.spectrumHeights = append(c.spectrumHeights, gmath.Clamp(1-db/minLevelDB, 0, 1))
+		clr := defaultColor
+		if id := c.spectrumDominant[i]; id != -1 {
+			clr = styles.PlotColorByID[id]
+		}
+		c.spectrumColors = append(c.spectrumColors, clr)
+	}
+	c.canvas.RenderSpectrum(c.spectrumHeights, c.spectrumColors)
+}
+
 func (c *StageController) onStopPressed() {
 	if c.currentMode != stagePlaying {
 		return
 	}
+	c.cancelSeek()
 	c.setMode(stageReady)
 	c.board.ClearProgram()
 	c.player.Pause()
@@ -589,6 +1145,8 @@ func (c *StageController) onStopPressed() {
 func (c *StageController) onPlayPressed() {
 	c.completed = false
 	c.bonusReached = false
+	c.bonusFailure = ""
+	c.score = sim.Score{}
 
 	switch c.currentMode {
 	case stageReady, stagePlaying:
@@ -597,47 +1155,82 @@ func (c *StageController) onPlayPressed() {
 		return
 	}
 
-	// Don't spawn a task if we don't need to.
-	if !c.synth.HasChanges() {
-		c.runPlayer()
+	stream, prog := c.synth.CreateStream()
+	if stream != nil {
+		player, err := c.scene.Audio().GetContext().NewPlayer(stream)
+		if err != nil {
+			fmt.Printf("create audio player: %v\n", err)
+			return
+		}
+		if c.player != nil {
+			c.player.Play()
+			c.player.Close()
+		}
+		c.player = player
+		c.player.SetVolume(c.state.EffectiveVolume)
+		c.stream = stream
+		c.prog = prog
+		c.speed = c.synth.GetPlaybackSpeed()
+	}
+
+	c.runPlayer()
+}
+
+func (c *StageController) onExportPressed() {
+	// Pressing the button during the export cancels it.
+	if c.exportTask != nil {
+		c.exportTask.Cancel()
 		return
 	}
 
-	c.setMode(stageEncoding)
+	dataPath := c.scene.Context().LocateGameData("export")
+	if dataPath == "" {
+		c.statusLabel.Label = "status: export failed (no data folder)"
+		return
+	}
+	dir := filepath.Join(filepath.Dir(dataPath), "export", time.Now().Format("2006-01-02_15-04-05"))
 
-	encodeTask := gtask.StartTask(func(ctx *gtask.TaskContext) {
-		ctx.Progress.Total = 1.0
-		samples, prog := c.synth.CreatePCM(&ctx.Progress.Current)
-		if samples != nil {
-			if c.player != nil {
-				c.player.Play()
-				c.player.Close()
-			}
-			pcm := generatePCM(samples.Left, samples.Right)
-			c.player = c.scene.Audio().GetContext().NewPlayerFromBytes(pcm)
-			c.player.SetVolume(c.state.EffectiveVolume)
-			c.samples = samples
-			c.prog = prog
-		}
+	export := c.synth.CreateExport()
+	exportTask := gtask.StartTask(func(ctx *gtask.TaskContext) error {
+		return export.Write(ctx.Context, dir, func(p float64) {
+			ctx.SetProgress(p, 1)
+		})
 	})
-	encodeTask.EventProgress.Connect(nil, func(p gtask.TaskProgress) {
-		c.statusLabel.Label = fmt.Sprintf("status: encoding (%d%%)", int(100*p.Current))
+	exportTask.EventProgress.Connect(nil, func(p gtask.TaskProgress) {
+		c.statusLabel.Label = fmt.Sprintf("status: exporting (%d%%)", int(100*p.Current))
+	})
+	exportTask.EventFailed.Connect(nil, func(err error) {
+		c.exportTask = nil
+		if errors.Is(err, context.Canceled) {
+			c.statusLabel.Label = "status: export cancelled"
+			return
+		}
+		fmt.Printf("export: %v\n", err)
+		c.statusLabel.Label = "status: export failed"
 	})
-	encodeTask.EventCompleted.Connect(nil, func(gsignal.Void) {
-		c.runPlayer()
+	exportTask.EventCompleted.Connect(nil, func(gsignal.Void) {
+		c.exportTask = nil
+		c.statusLabel.Label = "status: exported to " + dir
 	})
-	c.scene.AddObject(encodeTask)
+	c.exportTask = exportTask
+	c.scene.AddObject(exportTask)
 }
 
 func (c *StageController) runPlayer() {
-	c.player.Rewind()
-	c.player.Play()
-	c.board.StartProgram(c.prog)
-	c.canvas.Reset()
+	c.limiterReduction = 0
 	c.setMode(stagePlaying)
+	c.seekTo(c.loopStart)
+	// The pending seek starts the player when it's done.
+	if c.seekTask == nil {
+		c.player.Play()
+	}
 }
 
 func (c *StageController) changeScene(newScene ge.SceneController) {
+	if c.exportTask != nil {
+		c.exportTask.Cancel()
+	}
+	c.cancelSeek()
 	if c.player != nil {
 		c.player.Pause()
 	}
@@ -661,15 +1254,18 @@ func (c *StageController) updateStatusText() {
 			if c.bonusReached {
 				modeText = "completed (with bonus)"
 			} else {
-				modeText = "completed (no bonus)"
+				modeText = "completed (no bonus: " + c.bonusFailure + ")"
 			}
+			modeText += fmt.Sprintf(", score %d", c.score.Points)
 		} else {
 			modeText = "ready"
 		}
 	case stagePlaying:
 		modeText = "playing"
-	case stageEncoding:
-		modeText = "encoding"
+		if c.limiterReduction != 0 {
+			// The mix is too loud and the limiter is working.
+			modeText += fmt.Sprintf(" (limiter -%.1f dB)", c.limiterReduction)
+		}
 	default:
 		modeText = "unknown"
 	}
@@ -1,8 +1,6 @@
 package scenes
 
 import (
-	"bytes"
-	"encoding/binary"
 	"fmt"
 	"sort"
 	"time"
@@ -12,6 +10,7 @@ import (
 	"github.com/quasilyte/sinecord/assets"
 	"github.com/quasilyte/sinecord/eui"
 	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/gamedata"
 )
 
 type exprcFunc struct {
@@ -45,25 +44,6 @@ func initUI(scene *ge.Scene, root *widget.Container) {
 	scene.AddObject(uiObject)
 }
 
-func generatePCM(left, right []float32) []byte {
-	length := len(left)
-
-	a := float32(32768.0)
-
-	data := make([]int16, 2*length)
-
-	for i := 0; i < length; i++ {
-		data[2*i] = int16(a * left[i])
-		data[2*i+1] = int16(a * right[i])
-	}
-
-	var buf bytes.Buffer
-	buf.Grow(len(data) * 2)
-
-	binary.Write(&buf, binary.LittleEndian, data)
-	return buf.Bytes()
-}
-
 func formatDateISO8601(d time.Time, withTime bool) string {
 	s := fmt.Sprintf("%04d-%02d-%02d", d.Year(), d.Month(), d.Day())
 	if withTime {
@@ -71,3 +51,23 @@ func formatDateISO8601(d time.Time, withTime bool) string {
 	}
 	return s
 }
+
+func discoverTracks(ctx *ge.Context) []gamedata.Track {
+	tracks := make([]gamedata.Track, 10)
+
+	for i := range tracks {
+		t := &tracks[i]
+		t.Slot = i + 1
+		key := t.FileName()
+		if !ctx.CheckGameData(key) {
+			continue
+		}
+		if err := ctx.LoadGameData(key, &t); err != nil {
+			fmt.Printf("load %q error: %v", key, err)
+			continue
+		}
+		t.Slot = i + 1
+	}
+
+	return tracks
+}
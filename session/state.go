@@ -35,11 +35,18 @@ type PersistentData struct {
 	LevelsCompleted []LevelCompletionInfo `json:"levels_completed"`
 
 	VolumeLevel int `json:"volume_level"`
+
+	// SpectrumView selects the spectrum analyzer
+	// instead of the oscilloscope during the playback.
+	SpectrumView bool `json:"spectrum_view"`
 }
 
 type LevelCompletionInfo struct {
 	Name  string `json:"name"`
 	Bonus bool   `json:"bonus"`
+
+	// Score is the best score points, see sim.Score.
+	Score int `json:"score,omitempty"`
 }
 
 type LevelCompletionStatus int
@@ -50,7 +57,7 @@ const (
 	LevelCompletedWithBonus
 )
 
-func (d *PersistentData) UpdateLevelCompletion(level *gamedata.LevelData, bonus bool) {
+func (d *PersistentData) UpdateLevelCompletion(level *gamedata.LevelData, bonus bool, score int) {
 	var existingEntry *LevelCompletionInfo
 	for i := range d.LevelsCompleted {
 		l := &d.LevelsCompleted[i]
@@ -63,9 +70,13 @@ func (d *PersistentData) UpdateLevelCompletion(level *gamedata.LevelData, bonus
 		d.LevelsCompleted = append(d.LevelsCompleted, LevelCompletionInfo{
 			Name:  level.Name,
 			Bonus: bonus,
+			Score: score,
 		})
 		return
 	}
+	if score > existingEntry.Score {
+		existingEntry.Score = score
+	}
 	if existingEntry.Bonus {
 		return
 	}
@@ -84,6 +95,17 @@ func (d *PersistentData) GetLevelCompletionStatus(level *gamedata.LevelData) Lev
 	return LevelNotCompleted
 }
 
+// GetLevelScore returns the best level score.
+// It's zero if the level is not completed.
+func (d *PersistentData) GetLevelScore(level *gamedata.LevelData) int {
+	for _, entry := range d.LevelsCompleted {
+		if entry.Name == level.Name {
+			return entry.Score
+		}
+	}
+	return 0
+}
+
 func ReloadLanguage(ctx *ge.Context, language string) {
 	var id resource.RawID
 	switch language {
@@ -0,0 +1,468 @@
+// Package sim implements the mission rules without any graphics.
+//
+// The game stage drives the simulation frame by frame and draws its events,
+// the tests and tools can run it to completion in one go.
+// The results don't depend on the frame rate.
+package sim
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/gsignal"
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synth"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+type Config struct {
+	// Level is nil in the sandbox mode, there is no victory there.
+	Level *gamedata.LevelData
+
+	Scaler *gamedata.PlotScaler
+
+	Targets []gamedata.Target
+
+	Obstacles []gamedata.Obstacle
+}
+
+// Wave is a note activation effect.
+// It expands during its duration and hits the targets when it's finished.
+type Wave struct {
+	Pos gmath.Vec
+
+	// InstrumentID is an instrument slot ID.
+	InstrumentID int
+
+	Kind gamedata.InstrumentKind
+
+	// Time is the note activation time.
+	Time float64
+
+	Duration float64
+
+	// Radius is the final wave radius.
+	// It's less than FullRadius if the wave is stopped by an obstacle.
+	Radius float64
+
+	FullRadius float64
+
+	Reflections []Reflection
+}
+
+// FinishTime reports when the wave hits the targets.
+func (w *Wave) FinishTime() float64 {
+	return w.Time + w.Duration
+}
+
+func (w *Wave) reaches(t *Target) bool {
+	tolerance := t.Radius * 0.7
+	if t.Pos.DistanceTo(w.Pos) <= tolerance+w.Radius*0.7 {
+		return true
+	}
+	for _, r := range w.Reflections {
+		if r.reaches(w, t.Pos, tolerance) {
+			return true
+		}
+	}
+	return false
+}
+
+// WaveRadius returns the wave radius after t seconds of its expansion.
+func WaveRadius(t float64, scaler *gamedata.PlotScaler) float64 {
+	return math.Sqrt(t*0.9) * scaler.Factor
+}
+
+// Hit describes a target destroyed by a wave or a misplay.
+type Hit struct {
+	Time float64
+
+	Target *Target
+
+	InstrumentID int
+
+	Kind gamedata.InstrumentKind
+
+	// Penalty is set for the outline targets hit by a wrong instrument
+	// and for the ordered targets hit out of order.
+	Penalty bool
+
+	// OutOfOrder hits don't damage the target.
+	OutOfOrder bool
+
+	Destroyed bool
+}
+
+type Result struct {
+	Victory bool
+
+	// VictoryTime is a moment when the last required target was destroyed.
+	VictoryTime float64
+
+	Bonus bool
+
+	// BonusFailure explains why the bonus is not achieved.
+	// It's empty if there is no victory or the bonus is achieved.
+	BonusFailure string
+
+	Penalty bool
+
+	Hits []Hit
+
+	// Misplays are the penalty hits.
+	Misplays []Hit
+
+	// Score is only evaluated for the victory.
+	Score Score
+}
+
+type Mission struct {
+	config Config
+
+	prog   synth.Program
+	runner synth.ProgramRunner
+	events []synth.NoteActivation
+
+	// muteZones are the mute obstacles in the plot units.
+	muteZones []gmath.Rect
+
+	t            float64
+	victory      bool
+	victoryTime  float64
+	penalty      bool
+	optionalHits int
+	targetsLeft  int
+
+	// The waves accuracy, see Score.
+	notesFired int
+	notesHit   int
+
+	targets  []*Target
+	waves    []*Wave
+	hits     []Hit
+	misplays []Hit
+
+	// bonusFailure is evaluated at the victory time.
+	bonusFailure string
+	score        Score
+
+	EventWave    gsignal.Event[*Wave]
+	EventHit     gsignal.Event[Hit]
+	EventVictory gsignal.Event[Result]
+}
+
+func NewMission(config Config) *Mission {
+	m := &Mission{
+		config:    config,
+		muteZones: gamedata.MuteZones(config.Obstacles, config.Scaler),
+	}
+	m.Reset()
+	return m
+}
+
+// Reset restores the targets and drops the program.
+func (m *Mission) Reset() {
+	m.prog = synth.Program{}
+	m.events = nil
+	m.t = 0
+	m.victory = false
+	m.victoryTime = 0
+	m.penalty = false
+	m.optionalHits = 0
+	m.targetsLeft = 0
+	m.notesFired = 0
+	m.notesHit = 0
+	m.waves = m.waves[:0]
+	m.hits = nil
+	m.misplays = nil
+	m.bonusFailure = ""
+	m.score = Score{}
+
+	m.targets = make([]*Target, len(m.config.Targets))
+	for i, t := range m.config.Targets {
+		m.targets[i] = newTarget(i, t, m.config.Scaler)
+		if !m.targets[i].IsOptional() {
+			m.targetsLeft++
+		}
+	}
+}
+
+// Start resets the mission and schedules the program notes.
+//
+// The program mute zones are replaced by the mission mute obstacles.
+// The synthesizer should use the same zones, see gamedata.MuteZones.
+func (m *Mission) Start(prog synth.Program) {
+	m.Reset()
+	prog.MuteZones = m.muteZones
+	m.prog = prog
+	m.events = m.runner.RunProgram(prog)
+}
+
+// Targets returns all mission targets, including the destroyed ones.
+func (m *Mission) Targets() []*Target {
+	return m.targets
+}
+
+// Time reports the current simulation time.
+func (m *Mission) Time() float64 {
+	return m.t
+}
+
+// Advance runs the simulation up to t.
+//
+// The note activations and the wave hits are handled in their exact time order,
+// so the result doesn't depend on how the time is split between the calls.
+func (m *Mission) Advance(t float64) {
+	m.checkVictory()
+
+	for {
+		activationTime := math.Inf(1)
+		if len(m.events) != 0 {
+			activationTime = m.events[0].T
+		}
+		finishTime := math.Inf(1)
+		if len(m.waves) != 0 {
+			finishTime = m.waves[0].FinishTime()
+		}
+
+		switch {
+		case finishTime <= t && finishTime <= activationTime:
+			w := m.waves[0]
+			m.waves = m.waves[1:]
+			m.t = finishTime
+			// The moving targets are hit at their positions at the impact time.
+			m.moveTargets()
+			m.finishWave(w)
+			m.checkVictory()
+		case activationTime <= t:
+			e := m.events[0]
+			m.events = m.events[1:]
+			m.t = activationTime
+			m.activate(e)
+		default:
+			m.t = gmath.ClampMin(m.t, t)
+			m.moveTargets()
+			return
+		}
+	}
+}
+
+// Run plays the whole program and returns its result.
+func (m *Mission) Run(prog synth.Program) Result {
+	m.Start(prog)
+	m.Advance(prog.Length)
+	return m.Result()
+}
+
+// Result reports the current mission state.
+func (m *Mission) Result() Result {
+	result := Result{
+		Victory:  m.victory,
+		Penalty:  m.penalty,
+		Hits:     m.hits,
+		Misplays: m.misplays,
+	}
+	if m.victory {
+		result.VictoryTime = m.victoryTime
+		result.Bonus = m.bonusFailure == ""
+		result.BonusFailure = m.bonusFailure
+		result.Score = m.score
+	}
+	return result
+}
+
+// RunTrack plays the track the same way the game stage does.
+// The sound font is only used to map the instrument names to their kinds,
+// its SF2 data is not required.
+func RunTrack(config Config, track gamedata.Track, sf *synthdb.SoundFont) (Result, error) {
+	s, err := synth.LoadTrack(track, sf)
+	if err != nil {
+		return Result{}, err
+	}
+	return NewMission(config).Run(s.CreateProgram(-1)), nil
+}
+
+func (m *Mission) checkVictory() {
+	if m.victory || m.targetsLeft != 0 || m.config.Level == nil {
+		return
+	}
+	m.victory = true
+	m.victoryTime = m.t
+	m.bonusFailure = m.checkBonus()
+	m.score = newScore(m.prog, m.victoryTime, m.notesFired, m.notesHit)
+	m.EventVictory.Emit(m.Result())
+}
+
+// checkBonus returns a reason of the bonus failure.
+// An empty string means that the bonus is achieved.
+func (m *Mission) checkBonus() string {
+	objectives := m.config.Level.Bonus
+
+	if objectives.AvoidOptional && m.optionalHits > 0 {
+		return "an optional target is hit"
+	}
+
+	if objectives.AllTargets {
+		missed := 0
+		for _, t := range m.targets {
+			if !t.Destroyed {
+				missed++
+			}
+		}
+		if missed == 1 {
+			return "1 optional target is missed"
+		}
+		if missed != 0 {
+			return fmt.Sprintf("%d optional targets are missed", missed)
+		}
+	}
+
+	if objectives.AvoidPenalty && len(m.misplays) != 0 {
+		misplay := m.misplays[0]
+		if misplay.OutOfOrder {
+			return fmt.Sprintf("instrument %d broke the order at %.1fs", misplay.InstrumentID+1, misplay.Time)
+		}
+		return fmt.Sprintf("instrument %d misplayed at %.1fs", misplay.InstrumentID+1, misplay.Time)
+	}
+
+	numInstrumentsUsed := len(m.prog.Instruments)
+	if numInstrumentsUsed > objectives.MaxInstruments {
+		return fmt.Sprintf("%d instruments are used", numInstrumentsUsed)
+	}
+
+	for _, fn := range objectives.ForbiddenFuncs {
+		for _, inst := range m.prog.Instruments {
+			if inst.Func.UsesFunc(fn) {
+				return fmt.Sprintf("%s is used", fn)
+			}
+		}
+	}
+
+	return ""
+}
+
+func (m *Mission) moveTargets() {
+	for _, t := range m.targets {
+		if t.IsMoving() && !t.Destroyed {
+			t.Pos = t.PosAt(m.t, m.config.Scaler)
+		}
+	}
+}
+
+func (m *Mission) activate(e synth.NoteActivation) {
+	// A chord is a single activation, so it makes one wave
+	// positioned by the root note function.
+	inst := m.prog.Instruments[e.Index]
+	y := inst.Func.Run(e.T)
+	duration := e.Period * 0.95
+	w := &Wave{
+		Pos:          m.config.Scaler.ScaleXY(e.T, y),
+		InstrumentID: inst.ID,
+		Kind:         inst.Kind,
+		Time:         e.T,
+		Duration:     duration,
+		FullRadius:   WaveRadius(duration, m.config.Scaler),
+	}
+	w.Radius = w.FullRadius
+	for _, o := range m.config.Obstacles {
+		if o.Kind == gamedata.MuteObstacle {
+			continue
+		}
+		d := rectDistance(o.Rect, w.Pos)
+		if d >= w.FullRadius {
+			continue
+		}
+		// The wave stops growing when it touches the obstacle.
+		// A wave started inside of the obstacle is absorbed entirely.
+		w.Radius = math.Min(w.Radius, d)
+		if o.Kind == gamedata.MirrorObstacle && d > 0 {
+			w.Reflections = append(w.Reflections, Reflection{
+				Center:   mirrorPos(o.Rect, w.Pos),
+				Distance: d,
+			})
+		}
+	}
+
+	// The waves are kept sorted by their finish time;
+	// the equal ones are handled in the activation order.
+	i := sort.Search(len(m.waves), func(i int) bool {
+		return m.waves[i].FinishTime() > w.FinishTime()
+	})
+	m.waves = append(m.waves, nil)
+	copy(m.waves[i+1:], m.waves[i:])
+	m.waves[i] = w
+
+	m.EventWave.Emit(w)
+}
+
+func (m *Mission) finishWave(w *Wave) {
+	// The order is checked against the state before this wave,
+	// so a single wave can't hit several ordered targets in a row.
+	nextOrder := m.nextOrder()
+
+	m.notesFired++
+	damaged := false
+	for _, t := range m.targets {
+		if t.Destroyed || !t.canBeHitBy(w.Kind) || !t.IsActiveAt(m.t) {
+			continue
+		}
+		if !w.reaches(t) {
+			continue
+		}
+		hit := Hit{
+			Time:         m.t,
+			Target:       t,
+			InstrumentID: w.InstrumentID,
+			Kind:         w.Kind,
+		}
+		if t.Order != 0 && t.Order != nextOrder {
+			hit.Penalty = true
+			hit.OutOfOrder = true
+			m.penalty = true
+			m.misplays = append(m.misplays, hit)
+			m.EventHit.Emit(hit)
+			continue
+		}
+		hp := t.HP
+		destroyed := t.onDamage(w.InstrumentID)
+		if t.HP != hp {
+			damaged = true
+		}
+		if !destroyed {
+			continue
+		}
+		hit.Destroyed = true
+		hit.Penalty = t.Outline && t.Instrument != w.Kind
+		if hit.Penalty {
+			m.penalty = true
+			m.misplays = append(m.misplays, hit)
+		}
+		if t.IsOptional() {
+			m.optionalHits++
+		} else {
+			m.targetsLeft--
+		}
+		m.hits = append(m.hits, hit)
+		m.EventHit.Emit(hit)
+	}
+
+	if damaged {
+		m.notesHit++
+	}
+}
+
+// nextOrder returns the order of the targets that can be hit next.
+func (m *Mission) nextOrder() int {
+	next := 0
+	for _, t := range m.targets {
+		if t.Destroyed || t.Order == 0 {
+			continue
+		}
+		if next == 0 || t.Order < next {
+			next = t.Order
+		}
+	}
+	return next
+}
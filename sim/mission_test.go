@@ -0,0 +1,514 @@
+package sim
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synth"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+// testScaler is the same as the game plot scaler.
+var testScaler = &gamedata.PlotScaler{
+	Factor: 46,
+	Offset: gmath.Vec{X: 4, Y: 46 * 3},
+}
+
+type testLevel struct {
+	name  string
+	level *gamedata.LevelData
+}
+
+func loadTestLevels(t *testing.T) []testLevel {
+	t.Helper()
+
+	levelDir := filepath.Join("..", "assets", "_data", "raw")
+	tilesetData, err := os.ReadFile(filepath.Join(levelDir, "leveledit.tsj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tileset, err := gamedata.ParseTileset(tilesetData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	maps, err := filepath.Glob(filepath.Join(levelDir, "level", "*", "*", "map.tmj"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(maps) == 0 {
+		t.Fatal("found no levels")
+	}
+
+	var levels []testLevel
+	for _, filename := range maps {
+		dir := filepath.Dir(filename)
+		name := filepath.Base(filepath.Dir(dir)) + "/" + filepath.Base(dir)
+		mapData, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		level, err := gamedata.ParseLevel(tileset, testScaler, mapData)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		solutionData, err := os.ReadFile(filepath.Join(dir, "solution.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(solutionData, &level.Solution); err != nil {
+			t.Fatalf("%s: decode solution: %v", name, err)
+		}
+		levels = append(levels, testLevel{name: name, level: level})
+	}
+	return levels
+}
+
+func mustCompile(t *testing.T, src string) *exprc.FuncRunner {
+	t.Helper()
+	fn, err := exprc.Compile(src)
+	if err != nil {
+		t.Fatalf("compile %q: %v", src, err)
+	}
+	return fn
+}
+
+// newTestProgram returns a program with a bass instrument per note function.
+// Every instrument plays a note every second, its ID is its index.
+func newTestProgram(t *testing.T, length float64, funcs ...string) synth.Program {
+	t.Helper()
+	prog := synth.Program{Length: length}
+	for i, src := range funcs {
+		prog.Instruments = append(prog.Instruments, synth.ProgramInstrument{
+			ID:     i,
+			Index:  i,
+			Func:   mustCompile(t, src),
+			Period: mustCompile(t, "1"),
+			Kind:   gamedata.BassInstrument,
+		})
+	}
+	return prog
+}
+
+func newTestConfig(level *gamedata.LevelData) Config {
+	return Config{
+		Level:   level,
+		Scaler:  testScaler,
+		Targets: level.Targets,
+	}
+}
+
+func TestSolutions(t *testing.T) {
+	for _, l := range loadTestLevels(t) {
+		l := l
+		t.Run(l.name, func(t *testing.T) {
+			result, err := RunTrack(newTestConfig(l.level), l.level.Solution, synthdb.TimGM6mb)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Victory {
+				t.Fatalf("the solution doesn't beat the level (%d hits)", len(result.Hits))
+			}
+			if !result.Bonus {
+				t.Fatal("the solution doesn't achieve the bonus")
+			}
+			if result.VictoryTime <= 0 || result.VictoryTime > 20 {
+				t.Fatalf("unexpected victory time: %f", result.VictoryTime)
+			}
+		})
+	}
+}
+
+func TestAdvanceSteps(t *testing.T) {
+	levels := loadTestLevels(t)
+
+	// The hits must be the same regardless of the time steps.
+	for _, l := range levels {
+		s, err := synth.LoadTrack(l.level.Solution, synthdb.TimGM6mb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prog := s.CreateProgram(-1)
+
+		want := NewMission(newTestConfig(l.level)).Run(prog)
+
+		for _, step := range []float64{1.0 / 60, 1.0 / 7, 0.5} {
+			m := NewMission(newTestConfig(l.level))
+			m.Start(prog)
+			for m.Time() < prog.Length {
+				m.Advance(gmath.ClampMax(m.Time()+step, prog.Length))
+			}
+			have := m.Result()
+			if have.Victory != want.Victory || have.VictoryTime != want.VictoryTime || len(have.Hits) != len(want.Hits) {
+				t.Fatalf("%s: step %f: results mismatch", l.name, step)
+			}
+			for i := range have.Hits {
+				if have.Hits[i].Target.Index != want.Hits[i].Target.Index || have.Hits[i].InstrumentID != want.Hits[i].InstrumentID {
+					t.Fatalf("%s: step %f: hit[%d] mismatch", l.name, step, i)
+				}
+			}
+		}
+	}
+}
+
+func TestMissionHits(t *testing.T) {
+	bass := gamedata.BassInstrument
+	level := &gamedata.LevelData{
+		Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 1},
+	}
+	config := Config{
+		Level:  level,
+		Scaler: testScaler,
+		Targets: []gamedata.Target{
+			{Pos: testScaler.ScaleXY(1, 0), Instrument: bass, Size: gamedata.NormalTarget},
+			{Pos: testScaler.ScaleXY(2, 0), Instrument: bass, Size: gamedata.BigTarget},
+			{Pos: testScaler.ScaleXY(3, 0), Instrument: gamedata.AnyInstrument, Size: gamedata.SmallTarget},
+		},
+	}
+
+	// A single instrument can't destroy the big target:
+	// it needs two hits from the different instruments.
+	result := NewMission(config).Run(newTestProgram(t, 20, "0"))
+	if result.Victory {
+		t.Fatal("unexpected victory with a single instrument")
+	}
+	if len(result.Hits) != 2 || result.Hits[0].Target.Index != 0 || result.Hits[1].Target.Index != 2 {
+		t.Fatalf("unexpected hits: %+v", result.Hits)
+	}
+
+	result = NewMission(config).Run(newTestProgram(t, 20, "0", "0"))
+	if !result.Victory {
+		t.Fatal("expected a victory")
+	}
+	if result.Bonus {
+		t.Fatal("the bonus is achieved with too many instruments")
+	}
+	if result.Penalty {
+		t.Fatal("unexpected penalty")
+	}
+
+	// The mission ends with the big target, the optional targets
+	// after it and off the f(x)=0 line are never hit.
+	level.Bonus = gamedata.LevelBonusObjectives{MaxInstruments: 2, AllTargets: true}
+	config.Targets = config.Targets[:2]
+	for _, want := range []string{"1 optional target is missed", "2 optional targets are missed"} {
+		config.Targets = append(config.Targets, gamedata.Target{
+			Pos:        testScaler.ScaleXY(4, 2),
+			Instrument: gamedata.AnyInstrument,
+			Size:       gamedata.SmallTarget,
+		})
+		result = NewMission(config).Run(newTestProgram(t, 20, "0", "0"))
+		if !result.Victory || result.Bonus {
+			t.Fatalf("expected a victory without the bonus: %+v", result)
+		}
+		if result.BonusFailure != want {
+			t.Fatalf("bonus failure: have %q, want %q", result.BonusFailure, want)
+		}
+	}
+}
+
+func TestMissionMisplays(t *testing.T) {
+	level := &gamedata.LevelData{
+		Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 2, AvoidPenalty: true},
+	}
+	config := Config{
+		Level:  level,
+		Scaler: testScaler,
+		Targets: []gamedata.Target{
+			{Pos: testScaler.ScaleXY(1, 0), Instrument: gamedata.BassInstrument, Size: gamedata.NormalTarget, Outline: true},
+			{Pos: testScaler.ScaleXY(3, 0), Instrument: gamedata.KeyboardInstrument, Size: gamedata.NormalTarget},
+		},
+	}
+	prog := newTestProgram(t, 20, "0")
+	prog.Instruments[0].ID = 1
+	prog.Instruments[0].Kind = gamedata.KeyboardInstrument
+
+	result := NewMission(config).Run(prog)
+	if !result.Victory || !result.Penalty {
+		t.Fatalf("expected a victory with a penalty: %+v", result)
+	}
+	if len(result.Misplays) != 1 {
+		t.Fatalf("have %d misplays, want 1", len(result.Misplays))
+	}
+	misplay := result.Misplays[0]
+	if misplay.Target.Index != 0 || misplay.InstrumentID != 1 || misplay.Time != 1+0.95 {
+		t.Fatalf("unexpected misplay: %+v", misplay)
+	}
+	if result.Bonus {
+		t.Fatal("the bonus is achieved with a misplay")
+	}
+	if want := "instrument 2 misplayed at 1.9s"; result.BonusFailure != want {
+		t.Fatalf("bonus failure: have %q, want %q", result.BonusFailure, want)
+	}
+
+	level.Bonus.AvoidPenalty = false
+	if result := NewMission(config).Run(prog); !result.Bonus || result.BonusFailure != "" {
+		t.Fatalf("the misplays are allowed: %+v", result)
+	}
+}
+
+func TestMovingTarget(t *testing.T) {
+	prog := newTestProgram(t, 20, "0")
+	newConfig := func(motion gamedata.TargetMotion) Config {
+		return Config{
+			Level:  &gamedata.LevelData{Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 1}},
+			Scaler: testScaler,
+			Targets: []gamedata.Target{
+				{Pos: testScaler.ScaleXY(5, 2), Instrument: gamedata.BassInstrument, Size: gamedata.NormalTarget, Motion: motion},
+			},
+		}
+	}
+
+	// The waves never reach the target at its initial position.
+	if result := NewMission(newConfig(gamedata.TargetMotion{})).Run(prog); result.Victory {
+		t.Fatal("the static target is hit")
+	}
+
+	// The target goes down to y=0 and back every 4 seconds.
+	// Only the wave of the note played at x=5 hits it.
+	motion := gamedata.TargetMotion{
+		Kind:   gamedata.LinearMotion,
+		Offset: gmath.Vec{Y: -2},
+		Period: 4,
+	}
+	m := NewMission(newConfig(motion))
+	result := m.Run(prog)
+	if !result.Victory || len(result.Hits) != 1 {
+		t.Fatalf("expected a single hit victory: %+v", result)
+	}
+	hit := result.Hits[0]
+	if math.Abs(hit.Time-5.95) > 1e-9 {
+		t.Fatalf("hit time: have %f, want 5.95", hit.Time)
+	}
+	wantPos := testScaler.ScaleXY(5, 2-2*0.975)
+	if hit.Target.Pos.DistanceTo(wantPos) > 1e-6 {
+		t.Fatalf("hit position: have %v, want %v", hit.Target.Pos, wantPos)
+	}
+
+	// The trajectory is restarted with the program.
+	m.Start(prog)
+	if pos := m.Targets()[0].Pos; pos != testScaler.ScaleXY(5, 2) {
+		t.Fatalf("the target is not restored: %v", pos)
+	}
+}
+
+func TestTargetMotion(t *testing.T) {
+	fy := mustCompile(t, "sin(x)")
+	tests := []struct {
+		motion gamedata.TargetMotion
+		t      float64
+		want   gmath.Vec
+	}{
+		{gamedata.TargetMotion{}, 3, gmath.Vec{}},
+		{gamedata.TargetMotion{Kind: gamedata.LinearMotion, Offset: gmath.Vec{X: 2, Y: 1}, Period: 2}, 0, gmath.Vec{}},
+		{gamedata.TargetMotion{Kind: gamedata.LinearMotion, Offset: gmath.Vec{X: 2, Y: 1}, Period: 2}, 1, gmath.Vec{X: 2, Y: 1}},
+		{gamedata.TargetMotion{Kind: gamedata.LinearMotion, Offset: gmath.Vec{X: 2, Y: 1}, Period: 2}, 2.5, gmath.Vec{X: 1, Y: 0.5}},
+		{gamedata.TargetMotion{Kind: gamedata.CircularMotion, Radius: 1, Period: 4}, 0, gmath.Vec{X: 1}},
+		{gamedata.TargetMotion{Kind: gamedata.CircularMotion, Radius: 1, Period: 4}, 1, gmath.Vec{Y: 1}},
+		{gamedata.TargetMotion{Kind: gamedata.FormulaMotion, FuncY: fy}, math.Pi / 2, gmath.Vec{Y: 1}},
+	}
+	for _, test := range tests {
+		have := test.motion.OffsetAt(test.t)
+		if have.DistanceTo(test.want) > 1e-9 {
+			t.Fatalf("%+v at %f: have %v, want %v", test.motion, test.t, have, test.want)
+		}
+	}
+}
+
+func TestTargetRules(t *testing.T) {
+	bass := gamedata.BassInstrument
+	// Every instrument plays the notes at y=0 every second,
+	// the waves finish at 1.95, 2.95 and so on.
+	newProgram := func(numInstruments int) synth.Program {
+		funcs := make([]string, numInstruments)
+		for i := range funcs {
+			funcs[i] = "0"
+		}
+		return newTestProgram(t, 20, funcs...)
+	}
+	run := func(prog synth.Program, targets ...gamedata.Target) Result {
+		return NewMission(Config{
+			Level:   &gamedata.LevelData{Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 3, AvoidPenalty: true}},
+			Scaler:  testScaler,
+			Targets: targets,
+		}).Run(prog)
+	}
+
+	t.Run("window", func(t *testing.T) {
+		target := gamedata.Target{Pos: testScaler.ScaleXY(1, 0), Instrument: bass, Size: gamedata.NormalTarget}
+		// Without the window, it's hit at 1.95.
+		target.TimeFrom = 2.5
+		result := run(newProgram(1), target)
+		if result.Victory {
+			t.Fatal("the target is hit before its window")
+		}
+		// A wider target is hit by the 2nd wave inside of the window.
+		target.Size = gamedata.BigTarget
+		target.TimeFrom = 2
+		target.TimeTo = 3
+		result = run(newProgram(2), target)
+		if !result.Victory || math.Abs(result.VictoryTime-2.95) > 1e-9 {
+			t.Fatalf("expected a victory at 2.95: %+v", result)
+		}
+	})
+
+	t.Run("order", func(t *testing.T) {
+		first := gamedata.Target{Pos: testScaler.ScaleXY(3, 0), Instrument: bass, Size: gamedata.NormalTarget, Order: 1}
+		second := gamedata.Target{Pos: testScaler.ScaleXY(1, 0), Instrument: bass, Size: gamedata.NormalTarget, Order: 2}
+		result := run(newProgram(1), first, second)
+		if result.Victory {
+			t.Fatal("the second target is destroyed before the first one")
+		}
+		if len(result.Misplays) != 1 || !result.Misplays[0].OutOfOrder || result.Misplays[0].Target.Index != 1 {
+			t.Fatalf("expected an out of order misplay: %+v", result.Misplays)
+		}
+
+		second.Pos = testScaler.ScaleXY(5, 0)
+		result = run(newProgram(1), first, second)
+		if !result.Victory || !result.Bonus || len(result.Misplays) != 0 {
+			t.Fatalf("expected a clean victory: %+v", result)
+		}
+	})
+
+	t.Run("shield", func(t *testing.T) {
+		target := gamedata.Target{Pos: testScaler.ScaleXY(1, 0), Instrument: bass, Size: gamedata.NormalTarget, Shield: 3}
+		if result := run(newProgram(2), target); result.Victory {
+			t.Fatal("the shield is broken by 2 instruments")
+		}
+		result := run(newProgram(3), target)
+		if !result.Victory || len(result.Hits) != 1 || result.Hits[0].InstrumentID != 2 {
+			t.Fatalf("expected the 3rd instrument to destroy the target: %+v", result)
+		}
+	})
+}
+
+func TestObstacles(t *testing.T) {
+	bass := gamedata.BassInstrument
+	// plotRect converts the plot units rect to the canvas pixels.
+	plotRect := func(x0, y0, x1, y1 float64) gmath.Rect {
+		return gmath.Rect{Min: testScaler.ScaleXY(x0, y1), Max: testScaler.ScaleXY(x1, y0)}
+	}
+	run := func(prog synth.Program, obstacles []gamedata.Obstacle, targets ...gamedata.Target) Result {
+		return NewMission(Config{
+			Level:     &gamedata.LevelData{Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 1}},
+			Scaler:    testScaler,
+			Targets:   targets,
+			Obstacles: obstacles,
+		}).Run(prog)
+	}
+
+	// The notes are played at y=0 every second.
+	// The first wave starts at (1, 0) and finishes at 1.95.
+	// The obstacle is right above it.
+	side := gamedata.Target{Pos: testScaler.ScaleXY(1.6, 0), Instrument: bass, Size: gamedata.NormalTarget}
+	behind := gamedata.Target{Pos: testScaler.ScaleXY(1, 0.8), Instrument: bass, Size: gamedata.NormalTarget}
+	rect := plotRect(0, 0.3, 3, 0.5)
+
+	tests := []struct {
+		name      string
+		obstacles []gamedata.Obstacle
+		hitSide   bool
+		hitBehind bool
+	}{
+		{name: "none", hitSide: true, hitBehind: true},
+		{name: "wall", obstacles: []gamedata.Obstacle{{Kind: gamedata.WallObstacle, Rect: rect}}},
+		{name: "mirror", obstacles: []gamedata.Obstacle{{Kind: gamedata.MirrorObstacle, Rect: rect}}, hitSide: true},
+	}
+	for _, test := range tests {
+		if result := run(newTestProgram(t, 2, "0"), test.obstacles, side); result.Victory != test.hitSide {
+			t.Fatalf("%s: side target hit=%v, want %v", test.name, result.Victory, test.hitSide)
+		}
+		if result := run(newTestProgram(t, 2, "0"), test.obstacles, behind); result.Victory != test.hitBehind {
+			t.Fatalf("%s: target behind hit=%v, want %v", test.name, result.Victory, test.hitBehind)
+		}
+	}
+
+	t.Run("absorbed", func(t *testing.T) {
+		// The wave started inside of a wall can't hit anything.
+		obstacles := []gamedata.Obstacle{{Kind: gamedata.WallObstacle, Rect: plotRect(0.9, -0.1, 1.1, 0.1)}}
+		target := gamedata.Target{Pos: testScaler.ScaleXY(1, 0), Instrument: bass, Size: gamedata.BigTarget}
+		if result := run(newTestProgram(t, 2, "0"), obstacles, target); result.Victory {
+			t.Fatal("the absorbed wave hit the target")
+		}
+	})
+
+	t.Run("mute", func(t *testing.T) {
+		obstacles := []gamedata.Obstacle{{Kind: gamedata.MuteObstacle, Rect: plotRect(0.8, -0.2, 1.2, 0.2)}}
+		target := gamedata.Target{Pos: testScaler.ScaleXY(1, 0), Instrument: bass, Size: gamedata.NormalTarget}
+		m := NewMission(Config{
+			Level:     &gamedata.LevelData{Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 1}},
+			Scaler:    testScaler,
+			Targets:   []gamedata.Target{target},
+			Obstacles: obstacles,
+		})
+		var waveTimes []float64
+		m.EventWave.Connect(nil, func(w *Wave) {
+			waveTimes = append(waveTimes, w.Time)
+		})
+		result := m.Run(newTestProgram(t, 3.5, "0"))
+		if result.Victory {
+			t.Fatal("the muted note hit the target")
+		}
+		if len(waveTimes) != 2 || waveTimes[0] != 2 || waveTimes[1] != 3 {
+			t.Fatalf("expected the waves at 2 and 3, have %v", waveTimes)
+		}
+	})
+}
+
+func TestScore(t *testing.T) {
+	// The notes are played at y=0 every second.
+	run := func(x float64, shaping synth.ProgramInstrument) Result {
+		prog := newTestProgram(t, 4, "0")
+		prog.Instruments[0].Gate = shaping.Gate
+		prog.Instruments[0].Pan = shaping.Pan
+		prog.Instruments[0].Chord = shaping.Chord
+		return NewMission(Config{
+			Level:  &gamedata.LevelData{Bonus: gamedata.LevelBonusObjectives{MaxInstruments: 1}},
+			Scaler: testScaler,
+			Targets: []gamedata.Target{
+				{Pos: testScaler.ScaleXY(x, 0), Instrument: gamedata.BassInstrument, Size: gamedata.NormalTarget},
+			},
+		}).Run(prog)
+	}
+
+	tests := []struct {
+		x       float64
+		shaping synth.ProgramInstrument
+		want    Score
+	}{
+		// 512 for the time, 1000 for the accuracy, 490 for 2 nodes, 500 for 1 instrument.
+		{x: 1, want: Score{Points: 2502, Time: 1.95, NotesFired: 1, NotesHit: 1, FormulaNodes: 2, Instruments: 1}},
+		// The first wave misses, the second one hits.
+		{x: 2, want: Score{Points: 1752, Time: 2.95, NotesFired: 2, NotesHit: 1, FormulaNodes: 2, Instruments: 1}},
+		// The gate, pan and chord functions add 1+2+3 nodes: 460 for 8 nodes.
+		{
+			x: 1,
+			shaping: synth.ProgramInstrument{
+				Gate:  mustCompile(t, "0.5"),
+				Pan:   mustCompile(t, "sin(x)"),
+				Chord: mustCompile(t, "x+1"),
+			},
+			want: Score{Points: 2472, Time: 1.95, NotesFired: 1, NotesHit: 1, FormulaNodes: 8, Instruments: 1},
+		},
+	}
+	for _, test := range tests {
+		result := run(test.x, test.shaping)
+		if !result.Victory {
+			t.Fatalf("x=%v: expected a victory", test.x)
+		}
+		have := result.Score
+		if math.Abs(have.Time-test.want.Time) > 1e-9 {
+			t.Fatalf("x=%v: have time %v, want %v", test.x, have.Time, test.want.Time)
+		}
+		have.Time = test.want.Time
+		if have != test.want {
+			t.Fatalf("x=%v:\nhave %+v\nwant %+v", test.x, have, test.want)
+		}
+	}
+}
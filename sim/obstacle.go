@@ -0,0 +1,54 @@
+package sim
+
+import (
+	"github.com/quasilyte/gmath"
+)
+
+// Reflection is a wave reflected by a mirror obstacle.
+//
+// A reflected wave has the same radius as the original one,
+// but it's centered at the mirrored wave position.
+// It only affects the area on the original wave side of the mirror.
+type Reflection struct {
+	Center gmath.Vec
+
+	// Distance is how far the mirror is from the wave center.
+	Distance float64
+}
+
+// rectDistance returns the distance between the point and the rect.
+// It's zero for the points inside the rect.
+func rectDistance(r gmath.Rect, p gmath.Vec) float64 {
+	closest := closestRectPoint(r, p)
+	return closest.DistanceTo(p)
+}
+
+func closestRectPoint(r gmath.Rect, p gmath.Vec) gmath.Vec {
+	return gmath.Vec{
+		X: gmath.Clamp(p.X, r.Min.X, r.Max.X),
+		Y: gmath.Clamp(p.Y, r.Min.Y, r.Max.Y),
+	}
+}
+
+// mirrorPos reflects the point outside of the rect by its closest side.
+// If the closest rect point is a corner, the point is reflected by both sides.
+func mirrorPos(r gmath.Rect, p gmath.Vec) gmath.Vec {
+	closest := closestRectPoint(r, p)
+	return gmath.Vec{
+		X: 2*closest.X - p.X,
+		Y: 2*closest.Y - p.Y,
+	}
+}
+
+// reaches reports whether the reflected wave reaches the point.
+// The tolerance is added to the wave radius, like in the direct hit check.
+//
+// The points behind the mirror are closer to the reflection center
+// than to the original wave center, they're never reached.
+func (r Reflection) reaches(w *Wave, p gmath.Vec, tolerance float64) bool {
+	distance := p.DistanceTo(r.Center)
+	if distance < p.DistanceTo(w.Pos) {
+		return false
+	}
+	return distance <= tolerance+w.FullRadius*0.7
+}
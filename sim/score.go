@@ -0,0 +1,76 @@
+package sim
+
+import (
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/synth"
+)
+
+// Score is a numeric mission result, the higher is better.
+//
+// It's evaluated at the victory time: the notes played after
+// the last required target is destroyed don't matter.
+type Score struct {
+	Points int
+
+	// Time is how long it took to destroy all required targets.
+	Time float64
+
+	// NotesFired is a number of the waves finished before the victory.
+	// NotesHit is how many of them damaged at least one target.
+	NotesFired int
+	NotesHit   int
+
+	// FormulaNodes is a total size of the instrument functions:
+	// the note, period, gate, pan and chord ones.
+	// A chord shape or an interval list is not a function.
+	FormulaNodes int
+
+	Instruments int
+}
+
+const (
+	maxTimePoints       = 1000
+	maxAccuracyPoints   = 1000
+	maxComplexityPoints = 500
+	maxInstrumentPoints = 500
+
+	// MaxScorePoints is the best possible score.
+	MaxScorePoints = maxTimePoints + maxAccuracyPoints + maxComplexityPoints + maxInstrumentPoints
+
+	pointsPerFormulaNode = 5
+	pointsPerInstrument  = 100
+)
+
+func newScore(prog synth.Program, victoryTime float64, notesFired, notesHit int) Score {
+	s := Score{
+		Time:        victoryTime,
+		NotesFired:  notesFired,
+		NotesHit:    notesHit,
+		Instruments: len(prog.Instruments),
+	}
+	for _, inst := range prog.Instruments {
+		s.FormulaNodes += inst.Func.NumNodes() + inst.Period.NumNodes()
+		s.FormulaNodes += numNodes(inst.Gate) + numNodes(inst.Pan) + numNodes(inst.Chord)
+	}
+
+	points := 0.0
+	if prog.Length > 0 {
+		points += maxTimePoints * gmath.Clamp(1-victoryTime/prog.Length, 0, 1)
+	}
+	if notesFired != 0 {
+		points += maxAccuracyPoints * float64(notesHit) / float64(notesFired)
+	}
+	points += gmath.ClampMin(float64(maxComplexityPoints-pointsPerFormulaNode*s.FormulaNodes), 0)
+	points += gmath.ClampMin(float64(maxInstrumentPoints-pointsPerInstrument*(s.Instruments-1)), 0)
+	s.Points = int(points)
+
+	return s
+}
+
+func numNodes(fn *exprc.FuncRunner) int {
+	if fn == nil {
+		return 0
+	}
+	return fn.NumNodes()
+}
@@ -0,0 +1,128 @@
+package sim
+
+import (
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/gamedata"
+)
+
+// Target is a simulated target state.
+type Target struct {
+	// Index is the target index inside the mission config.
+	Index int
+
+	// Pos is a target position at the current simulation time.
+	Pos gmath.Vec
+
+	// Origin and Motion describe the target trajectory.
+	Origin gmath.Vec
+	Motion gamedata.TargetMotion
+
+	Instrument gamedata.InstrumentKind
+
+	Outline bool
+
+	Size gamedata.TargetSize
+
+	// Radius is a target size in pixels (the plot scale is applied).
+	Radius float64
+
+	// See gamedata.Target for the hit rules description.
+	TimeFrom float64
+	TimeTo   float64
+	Order    int
+	Shield   int
+
+	HP int
+
+	Destroyed bool
+
+	// prevHit is an ID of the instrument that did the last hit.
+	// The same instrument can't damage the target twice in a row.
+	prevHit int
+
+	// shieldHits are the IDs of the instruments that hit the shielded target.
+	shieldHits []int
+}
+
+func newTarget(index int, t gamedata.Target, scaler *gamedata.PlotScaler) *Target {
+	var size float64
+	hp := 1
+	switch t.Size {
+	case gamedata.SmallTarget:
+		size = 15
+	case gamedata.NormalTarget:
+		size = 30
+	case gamedata.BigTarget:
+		size = 60
+		hp = 2
+	default:
+		panic("unexpected target size")
+	}
+	if t.Shield != 0 {
+		hp = t.Shield
+	}
+
+	target := &Target{
+		Index:      index,
+		Origin:     t.Pos,
+		Motion:     t.Motion,
+		Instrument: t.Instrument,
+		Outline:    t.Outline,
+		Size:       t.Size,
+		Radius:     size / 2,
+		TimeFrom:   t.TimeFrom,
+		TimeTo:     t.TimeTo,
+		Order:      t.Order,
+		Shield:     t.Shield,
+		HP:         hp,
+		prevHit:    -1,
+	}
+	target.Pos = target.PosAt(0, scaler)
+	return target
+}
+
+// IsMoving reports whether the target has a trajectory.
+func (t *Target) IsMoving() bool {
+	return t.Motion.Kind != gamedata.StaticTarget
+}
+
+// PosAt returns the target position at the given time.
+func (t *Target) PosAt(time float64, scaler *gamedata.PlotScaler) gmath.Vec {
+	if !t.IsMoving() {
+		return t.Origin
+	}
+	return t.Origin.Add(scaler.ScaleOffset(t.Motion.OffsetAt(time)))
+}
+
+// IsActiveAt reports whether the target can be hit at the given time.
+func (t *Target) IsActiveAt(time float64) bool {
+	return time >= t.TimeFrom && (t.TimeTo == 0 || time <= t.TimeTo)
+}
+
+// IsOptional reports whether the target is not required for the victory.
+func (t *Target) IsOptional() bool {
+	return t.Instrument == gamedata.AnyInstrument
+}
+
+func (t *Target) canBeHitBy(kind gamedata.InstrumentKind) bool {
+	return t.Outline || t.Instrument == kind || t.Instrument == gamedata.AnyInstrument
+}
+
+// onDamage applies the instrument hit.
+// It reports whether the target is destroyed by it.
+func (t *Target) onDamage(instrumentID int) bool {
+	if t.Shield != 0 {
+		for _, id := range t.shieldHits {
+			if id == instrumentID {
+				return false
+			}
+		}
+		t.shieldHits = append(t.shieldHits, instrumentID)
+	} else if t.prevHit == instrumentID {
+		return false
+	}
+	t.HP--
+	t.prevHit = instrumentID
+	t.Destroyed = t.HP <= 0
+	return t.Destroyed
+}
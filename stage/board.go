@@ -5,7 +5,9 @@ import (
 	"github.com/quasilyte/gmath"
 	"github.com/quasilyte/gsignal"
 	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/sim"
 	"github.com/quasilyte/sinecord/styles"
+	"github.com/quasilyte/sinecord/synth"
 )
 
 type Board struct {
@@ -15,16 +17,12 @@ type Board struct {
 	ctx *Context
 
 	finished bool
-	victory  bool
-	penalty  bool
 	length   float64
 	t        float64
-	prog     SynthProgram
-	events   []noteActivation
-	runner   programRunner
+	prog     synth.Program
+
+	mission *sim.Mission
 
-	optionalHits   int
-	targetsLeft    int
 	targets        []*targetNode
 	effects        []*waveNode
 	pendingEffects []*waveNode
@@ -34,7 +32,7 @@ type Board struct {
 	config BoardConfig
 
 	EventNote    gsignal.Event[int]
-	EventVictory gsignal.Event[bool]
+	EventVictory gsignal.Event[sim.Result]
 }
 
 type BoardConfig struct {
@@ -45,63 +43,71 @@ type BoardConfig struct {
 	MaxInstruments int
 
 	Targets []gamedata.Target
+
+	Obstacles []gamedata.Obstacle
 }
 
 func NewBoard(ctx *Context, config BoardConfig) *Board {
-	return &Board{
+	b := &Board{
 		ctx:     ctx,
 		config:  config,
 		canvas:  config.Canvas,
 		length:  20,
 		signals: make([]*signalNode, 0, config.MaxInstruments),
-	}
+		mission: sim.NewMission(sim.Config{
+			Level:     config.Level,
+			Scaler:    ctx.Scaler,
+			Targets:   config.Targets,
+			Obstacles: config.Obstacles,
+		}),
+	}
+	b.mission.EventWave.Connect(nil, b.onWave)
+	b.mission.EventHit.Connect(nil, b.onHit)
+	b.mission.EventVictory.Connect(nil, func(result sim.Result) {
+		b.EventVictory.Emit(result)
+	})
+	return b
 }
 
 func (b *Board) Init(scene *ge.Scene) {
 	b.scene = scene
+	// The obstacles are static, they're never redeployed.
+	for _, o := range b.config.Obstacles {
+		b.canvas.AddGraphics(newObstacleNode(b.canvas, o))
+	}
 	b.deployTargets()
 }
 
-func (b *Board) StartProgram(prog SynthProgram) {
+func (b *Board) StartProgram(prog synth.Program) {
 	b.reset()
 	b.initProgram(prog)
 }
 
+// seekStep is a time step of the fast-forward simulation.
+const seekStep = 1.0 / 60.0
+
+// SeekProgram restarts the program and fast-forwards it to t.
+//
+// The simulation runs with a fixed time step, so the board effects
+// at t don't depend on the frame rate or the previous seeks.
+// It reports whether the program is finished.
+func (b *Board) SeekProgram(prog synth.Program, t float64) bool {
+	b.StartProgram(prog)
+	for b.t < t && !b.finished {
+		b.ProgramTick(gmath.ClampMax(seekStep, t-b.t))
+	}
+	return b.finished
+}
+
 func (b *Board) ClearProgram() {
 	b.reset()
+	b.mission.Reset()
 	b.deployTargets()
 }
 
-func (b *Board) onVictory() {
-	b.victory = true
-	b.EventVictory.Emit(b.isBonusAchieved())
-}
-
-func (b *Board) isBonusAchieved() bool {
-	objectives := b.config.Level.Bonus
-
-	if objectives.AvoidOptional && b.optionalHits > 0 {
-		return false
-	}
-
-	if objectives.AllTargets && len(b.targets) != 0 {
-		return false
-	}
-
-	numInstrumentsUsed := len(b.prog.Instruments)
-	if numInstrumentsUsed > objectives.MaxInstruments {
-		return false
-	}
-
-	for _, fn := range objectives.ForbiddenFuncs {
-		for _, inst := range b.prog.Instruments {
-			if inst.Func.UsesFunc(fn) {
-				return false
-			}
-		}
-	}
-
-	return true
+// Time reports the current program time.
+func (b *Board) Time() float64 {
+	return b.t
 }
 
 func (b *Board) ProgramTick(delta float64) bool {
@@ -125,9 +131,6 @@ func (b *Board) ProgramTick(delta float64) bool {
 		}
 		b.targets = liveTargets
 	}
-	if !b.victory && b.targetsLeft == 0 && b.config.Level != nil {
-		b.onVictory()
-	}
 
 	{
 		liveEffects := b.effects[:0]
@@ -141,59 +144,8 @@ func (b *Board) ProgramTick(delta float64) bool {
 		b.effects = liveEffects
 	}
 
-	for len(b.events) != 0 {
-		e := b.events[0]
-		if e.t > b.t {
-			break
-		}
-		b.events = b.events[1:]
-		y := b.prog.Instruments[e.index].Func.Run(e.t)
-		pos := b.ctx.Scaler.ScaleXY(e.t, y)
-		inst := b.prog.Instruments[e.index]
-		shape := gamedata.InstrumentShape(inst.Kind)
-		effect := newWaveNode(b.canvas, shape, pos, styles.PlotColorByID[e.id], inst.Period*0.95)
-		b.addWaveEffect(effect)
-		b.EventNote.Emit(e.id)
-
-		effect.EventFinished.Connect(nil, func(r float64) {
-			for _, t := range b.targets {
-				canHit := t.outline || t.instrument == inst.Kind || t.instrument == gamedata.AnyInstrument
-				if !canHit {
-					continue
-				}
-				if t.pos.DistanceTo(pos) > float64(t.r*0.7)+(r*0.7) {
-					continue
-				}
-				if !t.OnDamage(inst.ID) {
-					continue
-				}
-				clr1 := styles.TargetColor
-				clr2 := styles.TargetColor
-				clr3 := styles.TargetColor
-				isBonus := t.instrument == gamedata.AnyInstrument
-				if t.outline && t.instrument != inst.Kind {
-					b.penalty = true
-					clr1 = styles.TargetMissColorRed
-					clr2 = styles.TargetMissColorGreen
-					clr3 = styles.TargetMissColorBlue
-				}
-				if isBonus {
-					clr1 = styles.TargetColorBonus
-					clr2 = styles.TargetColorBonus
-					clr3 = styles.TargetColorBonus
-					b.optionalHits++
-				} else {
-					b.targetsLeft--
-				}
-				d := 2 * (float64(t.r) / b.ctx.Scaler.Factor)
-				shape := gamedata.InstrumentShape(t.instrument)
-				offset := gmath.Vec{X: 2, Y: 2}
-				b.addWaveEffect(newWaveNode(b.canvas, shape, t.pos.Sub(offset), clr1, d))
-				b.addWaveEffect(newWaveNode(b.canvas, shape, t.pos, clr2, d))
-				b.addWaveEffect(newWaveNode(b.canvas, shape, t.pos.Add(offset), clr3, d))
-			}
-		})
-	}
+	// The simulation decides what is hit; the board only draws it.
+	b.mission.Advance(b.t)
 
 	x := b.t
 	for i, sig := range b.signals {
@@ -213,14 +165,52 @@ func (b *Board) ProgramTick(delta float64) bool {
 	return b.finished
 }
 
+func (b *Board) onWave(w *sim.Wave) {
+	shape := gamedata.InstrumentShape(w.Kind)
+	clr := styles.PlotColorByID[w.InstrumentID]
+	effect := newWaveNode(b.canvas, shape, w.Pos, clr, w.Duration)
+	effect.maxRadius = w.Radius
+	b.addWaveEffect(effect)
+	// A reflection becomes visible when the wave reaches the mirror.
+	for _, r := range w.Reflections {
+		reflection := newWaveNode(b.canvas, shape, r.Center, clr, w.Duration)
+		reflection.minRadius = r.Distance
+		b.addWaveEffect(reflection)
+	}
+	b.EventNote.Emit(w.InstrumentID)
+}
+
+func (b *Board) onHit(hit sim.Hit) {
+	t := hit.Target
+	clr1 := styles.TargetColor
+	clr2 := styles.TargetColor
+	clr3 := styles.TargetColor
+	if hit.Penalty {
+		clr1 = styles.TargetMissColorRed
+		clr2 = styles.TargetMissColorGreen
+		clr3 = styles.TargetMissColorBlue
+	}
+	if t.IsOptional() {
+		clr1 = styles.TargetColorBonus
+		clr2 = styles.TargetColorBonus
+		clr3 = styles.TargetColorBonus
+	}
+	d := 2 * (t.Radius / b.ctx.Scaler.Factor)
+	shape := gamedata.InstrumentShape(t.Instrument)
+	offset := gmath.Vec{X: 2, Y: 2}
+	b.addWaveEffect(newWaveNode(b.canvas, shape, t.Pos.Sub(offset), clr1, d))
+	b.addWaveEffect(newWaveNode(b.canvas, shape, t.Pos, clr2, d))
+	b.addWaveEffect(newWaveNode(b.canvas, shape, t.Pos.Add(offset), clr3, d))
+}
+
 func (b *Board) addWaveEffect(effect *waveNode) {
 	b.pendingEffects = append(b.pendingEffects, effect)
 	b.canvas.AddGraphics(effect)
 }
 
-func (b *Board) initProgram(prog SynthProgram) {
+func (b *Board) initProgram(prog synth.Program) {
 	b.prog = prog
-	b.events = b.runner.RunProgram(prog)
+	b.mission.Start(prog)
 
 	for _, inst := range prog.Instruments {
 		sig := newSignalNode(b.canvas, styles.PlotColorByID[inst.ID])
@@ -232,13 +222,10 @@ func (b *Board) initProgram(prog SynthProgram) {
 }
 
 func (b *Board) deployTargets() {
-	for _, t := range b.config.Targets {
+	for _, t := range b.mission.Targets() {
 		n := newTargetNode(b, t)
 		b.canvas.AddGraphics(n)
 		b.targets = append(b.targets, n)
-		if t.Instrument != gamedata.AnyInstrument {
-			b.targetsLeft++
-		}
 	}
 }
 
@@ -252,6 +239,10 @@ func (b *Board) reset() {
 		effect.Dispose()
 	}
 	b.effects = b.effects[:0]
+	for _, effect := range b.pendingEffects {
+		effect.Dispose()
+	}
+	b.pendingEffects = b.pendingEffects[:0]
 
 	for _, target := range b.targets {
 		target.Dispose()
@@ -259,9 +250,5 @@ func (b *Board) reset() {
 	b.targets = b.targets[:0]
 
 	b.finished = false
-	b.victory = false
-	b.penalty = false
 	b.t = 0
-	b.optionalHits = 0
-	b.targetsLeft = 0
 }
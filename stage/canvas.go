@@ -152,6 +152,28 @@ func (c *Canvas) RenderWave(clr color.RGBA, lineWidth float64, data []float64) {
 	c.DrawPath(c.waves, p, float32(lineWidth), cs)
 }
 
+// RenderSpectrum draws the spectrum bars at the bottom of the canvas.
+// The heights are in [0, 1] range, 1 is the entire canvas height.
+func (c *Canvas) RenderSpectrum(heights []float64, colors []color.RGBA) {
+	c.waves.Clear()
+	if len(heights) == 0 {
+		return
+	}
+
+	const gap = 2
+	width := float32(c.waves.Bounds().Dx())
+	height := float32(c.waves.Bounds().Dy())
+	barWidth := width / float32(len(heights))
+	for i, h := range heights {
+		barHeight := float32(h) * height
+		if barHeight < 1 {
+			continue
+		}
+		x := float32(i) * barWidth
+		vector.DrawFilledRect(c.waves, x+gap/2, height-barHeight, barWidth-gap, barHeight, colors[i], false)
+	}
+}
+
 func (c *Canvas) SetPlotHidden(id int, hidden bool) {
 	c.plotsHidden[id] = hidden
 }
@@ -11,14 +11,14 @@ type Config struct {
 
 	Targets []gamedata.Target
 
+	Obstacles []gamedata.Obstacle
+
 	Track gamedata.Track
 
 	Mode gamedata.Mode
 }
 
 type Context struct {
-	runner *programRunner
-
 	config Config
 
 	Scaler *gamedata.PlotScaler
@@ -27,6 +27,5 @@ type Context struct {
 func NewContext(config Config) *Context {
 	return &Context{
 		config: config,
-		runner: &programRunner{},
 	}
 }
@@ -0,0 +1,52 @@
+package stage
+
+import (
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/styles"
+)
+
+type obstacleNode struct {
+	canvas   *Canvas
+	obstacle gamedata.Obstacle
+}
+
+func newObstacleNode(canvas *Canvas, o gamedata.Obstacle) *obstacleNode {
+	return &obstacleNode{
+		canvas:   canvas,
+		obstacle: o,
+	}
+}
+
+func (n *obstacleNode) IsDisposed() bool { return false }
+
+func (n *obstacleNode) Draw(screen *ebiten.Image) {
+	r := n.obstacle.Rect
+	x := float32(r.Min.X)
+	y := float32(r.Min.Y)
+	width := float32(r.Width())
+	height := float32(r.Height())
+	switch n.obstacle.Kind {
+	case gamedata.WallObstacle:
+		vector.DrawFilledRect(screen, x, y, width, height, styles.ObstacleWallColor, true)
+	case gamedata.MirrorObstacle:
+		vector.DrawFilledRect(screen, x, y, width, height, styles.ObstacleMirrorColor, true)
+		vector.StrokeRect(screen, x, y, width, height, 2, styles.SeparatorColor, true)
+	case gamedata.MuteObstacle:
+		vector.StrokeRect(screen, x, y, width, height, 1, styles.DisabledTextColor, true)
+		// The diagonal hatching marks the muted area.
+		const step = 12
+		for offset := float32(step); offset < width+height; offset += step {
+			x0, y0 := x+offset, y
+			if offset > width {
+				x0, y0 = x+width, y+offset-width
+			}
+			x1, y1 := x, y+offset
+			if offset > height {
+				x1, y1 = x+offset-height, y+height
+			}
+			vector.StrokeLine(screen, x0, y0, x1, y1, 1, styles.DisabledTextColor, true)
+		}
+	}
+}
@@ -1,55 +1,93 @@
 package stage
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/vector"
 	"github.com/quasilyte/ge"
 	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/assets"
 	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/sim"
 	"github.com/quasilyte/sinecord/styles"
 )
 
 type targetNode struct {
-	board      *Board
-	pos        gmath.Vec
-	instrument gamedata.InstrumentKind
-	disposed   bool
-	outline    bool
-	r          float32
-	color      ge.ColorScale
-	hp         int
-	prevHit    int
+	board    *Board
+	target   *sim.Target
+	disposed bool
+	color    ge.ColorScale
+
+	// trajectory is only drawn for the moving targets.
+	trajectory      vector.Path
+	trajectoryColor ge.ColorScale
+
+	// label shows the target order and its hit time window.
+	label *ge.Label
 }
 
-func newTargetNode(b *Board, t gamedata.Target) *targetNode {
-	var size float64
-	hp := 1
-	switch t.Size {
-	case gamedata.SmallTarget:
-		size = 15
-	case gamedata.NormalTarget:
-		size = 30
-	case gamedata.BigTarget:
-		size = 60
-		hp = 2
-	default:
-		panic("unexpected target size")
-	}
+// trajectoryStep is a time resolution of the drawn target trajectory.
+const trajectoryStep = 0.05
+
+// shieldRingGap is a distance between the shield rings.
+const shieldRingGap = 5
 
+func newTargetNode(b *Board, t *sim.Target) *targetNode {
 	var colorScale ge.ColorScale
 	colorScale.SetColor(styles.TargetColor)
-	return &targetNode{
-		board:      b,
-		pos:        t.Pos,
-		instrument: t.Instrument,
-		r:          float32(size / 2),
-		color:      colorScale,
-		hp:         hp,
-		outline:    t.Outline,
-		prevHit:    -1,
+	n := &targetNode{
+		board:  b,
+		target: t,
+		color:  colorScale,
+	}
+	if t.IsMoving() {
+		for time := 0.0; time <= b.length; time += trajectoryStep {
+			pos := t.PosAt(time, b.ctx.Scaler)
+			n.trajectory.LineTo(float32(pos.X), float32(pos.Y))
+		}
+		n.trajectoryColor = dimColor(colorScale, 0.25)
+	}
+
+	var labelParts []string
+	if t.Order != 0 {
+		labelParts = append(labelParts, fmt.Sprintf("#%d", t.Order))
+	}
+	switch {
+	case t.TimeTo != 0:
+		labelParts = append(labelParts, fmt.Sprintf("%g-%gs", t.TimeFrom, t.TimeTo))
+	case t.TimeFrom != 0:
+		labelParts = append(labelParts, fmt.Sprintf("%gs+", t.TimeFrom))
 	}
+	if len(labelParts) != 0 {
+		const labelWidth = 120
+		n.label = b.scene.NewLabel(assets.FontArcadeSmall)
+		n.label.Text = strings.Join(labelParts, " ")
+		n.label.Width = labelWidth
+		n.label.AlignHorizontal = ge.AlignHorizontalCenter
+		n.label.Pos.Base = &t.Pos
+		n.label.Pos.Offset = gmath.Vec{
+			X: -labelWidth / 2,
+			Y: t.Radius + float64(t.Shield*shieldRingGap) + 4,
+		}
+		n.label.ColorScale = colorScale
+	}
+
+	return n
+}
+
+// dimColor makes the color darker and more transparent.
+// The vertex colors are premultiplied, so every channel is scaled.
+func dimColor(clr ge.ColorScale, k float32) ge.ColorScale {
+	clr.R *= k
+	clr.G *= k
+	clr.B *= k
+	clr.A *= k
+	return clr
 }
 
-func (n *targetNode) IsDisposed() bool { return n.disposed }
+func (n *targetNode) IsDisposed() bool { return n.disposed || n.target.Destroyed }
 
 func (n *targetNode) Dispose() { n.disposed = true }
 
@@ -57,30 +95,37 @@ func (n *targetNode) Update(delta float64) {
 }
 
 func (n *targetNode) Draw(screen *ebiten.Image) {
-	shape := gamedata.InstrumentShape(n.instrument)
-	isOutline := n.outline
+	t := n.target
+	shape := gamedata.InstrumentShape(t.Instrument)
+	isOutline := t.Outline
 	clr := n.color
-	if n.instrument == gamedata.AnyInstrument {
+	if t.IsOptional() {
 		isOutline = true
 		clr.SetColor(styles.TargetColorBonus)
 	}
-	r := float32(n.r)
+	// The targets outside of their time window can't be hit.
+	if !t.IsActiveAt(n.board.Time()) {
+		clr = dimColor(clr, 0.35)
+	}
+	if t.IsMoving() {
+		n.board.canvas.DrawPath(screen, n.trajectory, 1, n.trajectoryColor)
+	}
+	x := float32(t.Pos.X)
+	y := float32(t.Pos.Y)
+	r := float32(t.Radius)
 	if isOutline {
-		n.board.canvas.drawShape(screen, shape, float32(n.pos.X), float32(n.pos.Y), r, 0, clr)
+		n.board.canvas.drawShape(screen, shape, x, y, r, 0, clr)
 	} else {
-		n.board.canvas.drawFilledShape(screen, shape, float32(n.pos.X), float32(n.pos.Y), r, 0, clr)
+		n.board.canvas.drawFilledShape(screen, shape, x, y, r, 0, clr)
 	}
-}
-
-func (n *targetNode) OnDamage(instrumentID int) bool {
-	if n.prevHit == instrumentID {
-		return false
+	// Every ring is a hit from one more instrument that is required.
+	if t.Shield != 0 {
+		for i := 1; i <= t.HP; i++ {
+			n.board.canvas.drawShape(screen, shape, x, y, r+float32(i*shieldRingGap), 0, clr)
+		}
 	}
-	n.hp--
-	n.prevHit = instrumentID
-	destroyed := n.hp <= 0
-	if destroyed {
-		n.Dispose()
+	if n.label != nil {
+		n.label.ColorScale = clr
+		n.label.Draw(screen)
 	}
-	return destroyed
 }
@@ -7,8 +7,8 @@ import (
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/quasilyte/ge"
 	"github.com/quasilyte/gmath"
-	"github.com/quasilyte/gsignal"
 	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/sim"
 )
 
 type waveNode struct {
@@ -22,7 +22,10 @@ type waveNode struct {
 	r        float64
 	duration float64
 
-	EventFinished gsignal.Event[float64]
+	// The wave is not drawn until it reaches the minRadius.
+	// It stops growing at maxRadius.
+	minRadius float64
+	maxRadius float64
 
 	disposed bool
 }
@@ -32,12 +35,13 @@ func newWaveNode(canvas *Canvas, shape gamedata.Shape, pos gmath.Vec, clr color.
 	colorScale.SetColor(clr)
 
 	return &waveNode{
-		shape:    shape,
-		canvas:   canvas,
-		duration: duration,
-		color:    colorScale,
-		x:        float32(pos.X),
-		y:        float32(pos.Y),
+		shape:     shape,
+		canvas:    canvas,
+		duration:  duration,
+		color:     colorScale,
+		maxRadius: math.Inf(1),
+		x:         float32(pos.X),
+		y:         float32(pos.Y),
 	}
 }
 
@@ -49,11 +53,9 @@ func (n *waveNode) Dispose() {
 
 func (n *waveNode) Update(delta float64) {
 	n.t = gmath.ClampMax(n.t+delta, n.duration)
-	n.r = math.Sqrt(n.t*0.9) * n.canvas.ctx.Scaler.Factor
+	n.r = gmath.ClampMax(sim.WaveRadius(n.t, n.canvas.ctx.Scaler), n.maxRadius)
 	if n.t == n.duration {
 		n.Dispose()
-		n.EventFinished.Emit(n.r)
-		return
 	}
 }
 
@@ -65,6 +67,9 @@ func (n *waveNode) Draw(screen *ebiten.Image) {
 	default:
 		angle = gmath.Rad(1.5 * (n.t / n.duration))
 	}
+	if n.r < n.minRadius || n.r == 0 {
+		return
+	}
 	r := float32(n.r)
 	n.canvas.drawShape(screen, n.shape, n.x, n.y, r, angle, n.color)
 }
@@ -15,6 +15,9 @@ var (
 	TargetMissColorBlue  = ge.RGB(0x0326ff)
 	TargetColorBonus     = ge.RGB(0xd7d7d7)
 
+	ObstacleWallColor   = ge.RGB(0x3c4b58)
+	ObstacleMirrorColor = ge.RGB(0x2a4f66)
+
 	NormalTextColor   = ge.RGB(0x9dd793)
 	DisabledTextColor = ge.RGB(0x5a7a91)
 	CaretColor        = ge.RGB(0xfed846)
@@ -0,0 +1,197 @@
+package synth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synthdb"
+	"github.com/quasilyte/sinecord/synthdb/sf2test"
+	"github.com/sinshu/go-meltysynth/meltysynth"
+)
+
+var updateGolden = flag.Bool("update", false, "regenerate the golden files")
+
+// goldenFingerprint is a compact description of the rendered track.
+// The notes guard the functions evaluation and the note mapping,
+// the RMS hash guards the synthesis.
+type goldenFingerprint struct {
+	Notes     []Note `json:"notes"`
+	BlockSize int    `json:"block_size"`
+	NumBlocks int    `json:"num_blocks"`
+	RMSHash   string `json:"rms_hash"`
+}
+
+// goldenSoundFont returns the TimGM6mb instruments backed by the generated fixture.
+// The real SF2 file is never used here: the goldens must not depend
+// on what is installed on the machine.
+func goldenSoundFont(t *testing.T) *synthdb.SoundFont {
+	t.Helper()
+
+	// Every TimGM6mb preset index should be valid, so the fixture
+	// has the same number of presets (the extra ones go to the bank 1).
+	numPresets := 0
+	for _, inst := range synthdb.TimGM6mb.Instruments {
+		if inst.Index >= numPresets && !inst.IsPercussion() {
+			numPresets = inst.Index + 1
+		}
+	}
+	presets := make([]sf2test.Preset, 0, numPresets+1)
+	for i := 0; i < numPresets; i++ {
+		presets = append(presets, sf2test.Preset{Name: fmt.Sprintf("Preset %03d", i), Bank: i / 128, Patch: i % 128})
+	}
+	presets = append(presets, sf2test.Preset{Name: "Standard Kit", Bank: synthdb.PercussionBank})
+
+	data, err := meltysynth.NewSoundFont(bytes.NewReader(sf2test.Generate(presets)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Load modifies the instruments, the global font must stay intact.
+	sf := &synthdb.SoundFont{Name: synthdb.TimGM6mb.Name}
+	for _, inst := range synthdb.TimGM6mb.Instruments {
+		instCopy := *inst
+		sf.Instruments = append(sf.Instruments, &instCopy)
+	}
+	if err := sf.Load(data); err != nil {
+		t.Fatal(err)
+	}
+	return sf
+}
+
+func renderGoldenFingerprint(t *testing.T, track gamedata.Track, sf *synthdb.SoundFont) goldenFingerprint {
+	t.Helper()
+
+	s, err := LoadTrack(track, sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples, _, err := s.CreatePCM(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fp := goldenFingerprint{
+		Notes:     s.CreateNotes(),
+		BlockSize: samples.PerSecond / 10,
+	}
+	if fp.Notes == nil {
+		fp.Notes = []Note{}
+	}
+
+	// The RMS values are rounded, so the insignificant
+	// floating point differences don't change the hash.
+	h := sha256.New()
+	for from := 0; from < len(samples.Left); from += fp.BlockSize {
+		to := from + fp.BlockSize
+		if to > len(samples.Left) {
+			to = len(samples.Left)
+		}
+		sum := 0.0
+		for i := from; i < to; i++ {
+			l := float64(samples.Left[i])
+			r := float64(samples.Right[i])
+			sum += l*l + r*r
+		}
+		rms := math.Sqrt(sum / float64(2*(to-from)))
+		fmt.Fprintf(h, "%.4f\n", rms)
+		fp.NumBlocks++
+	}
+	fp.RMSHash = hex.EncodeToString(h.Sum(nil))
+
+	return fp
+}
+
+func TestGoldenSolutions(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "assets", "_data", "raw", "level", "*", "*", "solution.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("found no level solutions")
+	}
+
+	sf := goldenSoundFont(t)
+
+	for _, filename := range files {
+		filename := filename
+		mission := filepath.Base(filepath.Dir(filename))
+		act := filepath.Base(filepath.Dir(filepath.Dir(filename)))
+		name := act + "_" + mission
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var track gamedata.Track
+			if err := json.Unmarshal(data, &track); err != nil {
+				t.Fatalf("decode %s: %v", filename, err)
+			}
+
+			have := renderGoldenFingerprint(t, track, sf)
+
+			goldenFile := filepath.Join("testdata", "golden", name+".json")
+			if *updateGolden {
+				encoded, err := json.MarshalIndent(have, "", "  ")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.MkdirAll(filepath.Dir(goldenFile), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenFile, append(encoded, '\n'), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			goldenData, err := os.ReadFile(goldenFile)
+			if err != nil {
+				t.Fatalf("%v (run the test with -update to create it)", err)
+			}
+			var want goldenFingerprint
+			if err := json.Unmarshal(goldenData, &want); err != nil {
+				t.Fatalf("decode %s: %v", goldenFile, err)
+			}
+			compareGoldenFingerprints(t, have, want)
+		})
+	}
+}
+
+func compareGoldenFingerprints(t *testing.T, have, want goldenFingerprint) {
+	t.Helper()
+
+	sameNote := func(a, b Note) bool {
+		return math.Abs(a.Time-b.Time) < 1e-9 &&
+			math.Abs(a.Duration-b.Duration) < 1e-9 &&
+			a.Instrument == b.Instrument &&
+			a.Channel == b.Channel &&
+			a.Key == b.Key &&
+			a.Velocity == b.Velocity
+	}
+	for i := 0; i < len(have.Notes) && i < len(want.Notes); i++ {
+		if !sameNote(have.Notes[i], want.Notes[i]) {
+			t.Fatalf("note[%d] mismatch:\nhave %+v\nwant %+v", i, have.Notes[i], want.Notes[i])
+		}
+	}
+	if len(have.Notes) != len(want.Notes) {
+		t.Fatalf("notes count mismatch: have %d, want %d", len(have.Notes), len(want.Notes))
+	}
+
+	if have.BlockSize != want.BlockSize || have.NumBlocks != want.NumBlocks {
+		t.Fatalf("length mismatch: have %d blocks of %d, want %d blocks of %d",
+			have.NumBlocks, have.BlockSize, want.NumBlocks, want.BlockSize)
+	}
+	if have.RMSHash != want.RMSHash {
+		t.Fatalf("RMS hash mismatch: have %s, want %s", have.RMSHash, want.RMSHash)
+	}
+}
@@ -0,0 +1,64 @@
+package synth
+
+import (
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+type instrument struct {
+	fx    string
+	oldFx string
+
+	periodFunc    string
+	oldPeriodFunc string
+	gateFunc      string
+	panFunc       string
+	chordFunc     string
+
+	compiledFx     *exprc.FuncRunner
+	compiledPeriod *exprc.FuncRunner
+	compiledGate   *exprc.FuncRunner
+	compiledPan    *exprc.FuncRunner
+	compiledChord  *exprc.FuncRunner
+
+	// chord is a parsed chord shape.
+	// It's ignored if the chord is defined by a function.
+	chord synthdb.Chord
+
+	instrumentIndex int
+	patchNumber     int32
+	bank            int32
+	percussion      bool
+	keyRange        [2]int32
+	velocity        int32
+
+	// glideRange is a pitch bend range in semitones;
+	// 0 means that the glide mode is off.
+	glideRange int32
+
+	enabled      bool
+	mappedVolume int32
+	volume       float64
+	reverbSend   float64
+	chorusSend   float64
+	kind         gamedata.InstrumentKind
+}
+
+func newInstrument() *instrument {
+	return &instrument{
+		keyRange: [2]int32{0, 127},
+		velocity: defaultNoteVelocity,
+	}
+}
+
+func (inst *instrument) SetPeriod(src string, period *exprc.FuncRunner) {
+	inst.oldPeriodFunc = inst.periodFunc
+	inst.periodFunc = src
+	inst.compiledPeriod = period
+}
+
+func (inst *instrument) SetFx(fx string) {
+	inst.oldFx = inst.fx
+	inst.fx = fx
+}
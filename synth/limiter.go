@@ -0,0 +1,150 @@
+package synth
+
+import (
+	"math"
+)
+
+const (
+	// limiterCeiling is the max sample value after the limiting (-1 dBFS).
+	limiterCeiling = 0.891
+
+	limiterLookahead = 0.005 // seconds
+	limiterRelease   = 0.150 // seconds
+)
+
+// LimiterStats describes the limiter activity.
+type LimiterStats struct {
+	// InputPeak is the max absolute sample value before the limiting.
+	InputPeak float64
+
+	// MaxReduction is the max gain reduction in dB (a positive value).
+	MaxReduction float64
+
+	// Limited is the number of samples that would clip without the limiter.
+	Limited int
+}
+
+// IsClipping reports whether the mix would clip without the limiter.
+func (s LimiterStats) IsClipping() bool {
+	return s.Limited != 0
+}
+
+// limiter is a look-ahead peak limiter.
+//
+// The gain starts going down before the peak arrives,
+// so the ceiling is never exceeded and there is no hard clipping.
+// After the peak, the gain is smoothly restored.
+//
+// The limiter is stateful, but the result doesn't depend on
+// the block sizes it's fed with.
+type limiter struct {
+	lookahead int
+
+	releaseCoef float64
+
+	// history holds the last lookahead target gains;
+	// their average is the attack-smoothed gain.
+	history    []float64
+	historyPos int
+	historySum float64
+
+	gain float64
+
+	peaks []float64
+
+	stats LimiterStats
+}
+
+func newLimiter(sampleRate float64) *limiter {
+	l := &limiter{
+		lookahead:   int(limiterLookahead * sampleRate),
+		releaseCoef: 1 - math.Exp(-1/(limiterRelease*sampleRate)),
+	}
+	if l.lookahead < 1 {
+		l.lookahead = 1
+	}
+	l.history = make([]float64, l.lookahead)
+	l.Reset()
+	return l
+}
+
+func (l *limiter) Reset() {
+	for i := range l.history {
+		l.history[i] = 1
+	}
+	l.historyPos = 0
+	l.historySum = float64(len(l.history))
+	l.gain = 1
+	l.stats = LimiterStats{}
+}
+
+// Process limits the first n samples.
+// The samples after n are used as a look-ahead;
+// the missing look-ahead samples are treated as silence.
+func (l *limiter) Process(left, right []float32, n int) {
+	// peaks[i] is a max absolute value of the samples [i, i+lookahead].
+	// It's computed with a monotonic queue of the candidate indexes.
+	if cap(l.peaks) < len(left) {
+		l.peaks = make([]float64, len(left))
+	}
+	peaks := l.peaks[:len(left)]
+	for i := range peaks {
+		peaks[i] = math.Max(math.Abs(float64(left[i])), math.Abs(float64(right[i])))
+	}
+	queue := make([]int, 0, l.lookahead+1)
+	for i := 0; i < len(peaks) && i <= l.lookahead; i++ {
+		queue = pushPeak(queue, peaks, i)
+	}
+
+	for i := 0; i < n; i++ {
+		for queue[0] < i {
+			queue = queue[1:]
+		}
+		windowPeak := peaks[queue[0]]
+		if next := i + l.lookahead + 1; next < len(peaks) {
+			queue = pushPeak(queue, peaks, next)
+		}
+
+		target := 1.0
+		if windowPeak > limiterCeiling {
+			target = limiterCeiling / windowPeak
+		}
+
+		// Attack: the average of the last targets reaches the
+		// window target right at the peak sample.
+		l.historySum += target - l.history[l.historyPos]
+		l.history[l.historyPos] = target
+		l.historyPos++
+		if l.historyPos == len(l.history) {
+			l.historyPos = 0
+		}
+		attackGain := math.Min(l.historySum/float64(len(l.history)), 1)
+
+		if attackGain < l.gain {
+			l.gain = attackGain
+		} else {
+			l.gain += (attackGain - l.gain) * l.releaseCoef
+		}
+
+		peak := peaks[i]
+		if peak > l.stats.InputPeak {
+			l.stats.InputPeak = peak
+		}
+		if peak > limiterCeiling {
+			l.stats.Limited++
+		}
+		if reduction := -20 * math.Log10(l.gain); reduction > l.stats.MaxReduction {
+			l.stats.MaxReduction = reduction
+		}
+
+		left[i] *= float32(l.gain)
+		right[i] *= float32(l.gain)
+	}
+}
+
+func pushPeak(queue []int, peaks []float64, i int) []int {
+	for len(queue) != 0 && peaks[queue[len(queue)-1]] <= peaks[i] {
+		queue = queue[:len(queue)-1]
+	}
+	return append(queue, i)
+}
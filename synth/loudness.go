@@ -0,0 +1,224 @@
+package synth
+
+import (
+	"math"
+)
+
+// DefaultLoudness is a loudness the offline renders are normalized to.
+// It's a common target for the game and streaming audio.
+const DefaultLoudness = -16.0 // LUFS
+
+// maxNormalizationGain limits the quiet tracks amplification (+12 dB),
+// so an almost silent track doesn't become a noise.
+const maxNormalizationGain = 4.0
+
+// AudioStats is a result of the samples analysis.
+type AudioStats struct {
+	// Peak is the max absolute sample value; 1 is a full scale.
+	Peak float64
+
+	// RMS is the root mean square of both channels samples.
+	RMS float64
+
+	// Loudness is an integrated loudness in LUFS
+	// measured in the ITU-R BS.1770 way: K-weighted and gated.
+	// It's -Inf for a silent track.
+	Loudness float64
+
+	// Clipped is the number of samples that exceed the full scale.
+	Clipped int
+}
+
+func (s AudioStats) PeakDB() float64 { return gainToDB(s.Peak) }
+
+func (s AudioStats) RMSDB() float64 { return gainToDB(s.RMS) }
+
+// silenceDB is the lowest reported level.
+const silenceDB = -120.0
+
+func gainToDB(v float64) float64 {
+	return math.Max(20*math.Log10(v), silenceDB)
+}
+
+// Analyze measures the samples levels.
+func (set *SampleSet) Analyze() AudioStats {
+	var stats AudioStats
+	var sumSquares float64
+	for i := range set.Left {
+		for _, v := range [2]float32{set.Left[i], set.Right[i]} {
+			x := math.Abs(float64(v))
+			if x > stats.Peak {
+				stats.Peak = x
+			}
+			if x > 1 {
+				stats.Clipped++
+			}
+			sumSquares += x * x
+		}
+	}
+	if len(set.Left) != 0 {
+		stats.RMS = math.Sqrt(sumSquares / float64(2*len(set.Left)))
+	}
+	stats.Loudness = integratedLoudness(set)
+	return stats
+}
+
+// Normalize changes the samples level to match the target loudness.
+// The peaks that exceed the -1 dBFS ceiling after that are limited.
+//
+// It returns the stats of the normalized samples.
+func (set *SampleSet) Normalize(targetLoudness float64) AudioStats {
+	_, stats := set.normalize(targetLoudness)
+	return stats
+}
+
+func (set *SampleSet) normalize(targetLoudness float64) (float64, AudioStats) {
+	gain := normalizationGain(set.Analyze().Loudness, targetLoudness)
+	if gain != 1 {
+		for i := range set.Left {
+			set.Left[i] *= float32(gain)
+			set.Right[i] *= float32(gain)
+		}
+	}
+	newLimiter(float64(set.PerSecond)).Process(set.Left, set.Right, len(set.Left))
+	return gain, set.Analyze()
+}
+
+func normalizationGain(loudness, target float64) float64 {
+	if math.IsInf(loudness, -1) || math.IsNaN(loudness) {
+		return 1
+	}
+	gain := math.Pow(10, (target-loudness)/20)
+	return math.Min(gain, maxNormalizationGain)
+}
+
+// biquad is a second order IIR filter (direct form I).
+type biquad struct {
+	b0, b1, b2 float64
+	a1, a2     float64
+
+	x1, x2 float64
+	y1, y2 float64
+}
+
+func (f *biquad) next(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeightingFilters returns the BS.1770 K-weighting filter stages:
+// a high shelf that models the head acoustics and a high-pass filter.
+// The coefficients are derived for the given sample rate.
+func kWeightingFilters(sampleRate float64) [2]biquad {
+	const (
+		shelfGain = 4.0 // dB
+		shelfFreq = 1500.0
+		shelfQ    = 1 / math.Sqrt2
+
+		highPassFreq = 38.0
+		highPassQ    = 0.5
+	)
+
+	var stages [2]biquad
+
+	{
+		a := math.Pow(10, shelfGain/40)
+		w0 := 2 * math.Pi * shelfFreq / sampleRate
+		alpha := math.Sin(w0) / (2 * shelfQ)
+		cos := math.Cos(w0)
+		sqrtA := math.Sqrt(a)
+		a0 := (a + 1) - (a-1)*cos + 2*sqrtA*alpha
+		stages[0] = biquad{
+			b0: a * ((a + 1) + (a-1)*cos + 2*sqrtA*alpha) / a0,
+			b1: -2 * a * ((a - 1) + (a+1)*cos) / a0,
+			b2: a * ((a + 1) + (a-1)*cos - 2*sqrtA*alpha) / a0,
+			a1: 2 * ((a - 1) - (a+1)*cos) / a0,
+			a2: ((a + 1) - (a-1)*cos - 2*sqrtA*alpha) / a0,
+		}
+	}
+
+	{
+		w0 := 2 * math.Pi * highPassFreq / sampleRate
+		alpha := math.Sin(w0) / (2 * highPassQ)
+		cos := math.Cos(w0)
+		a0 := 1 + alpha
+		stages[1] = biquad{
+			b0: (1 + cos) / 2 / a0,
+			b1: -(1 + cos) / a0,
+			b2: (1 + cos) / 2 / a0,
+			a1: -2 * cos / a0,
+			a2: (1 - alpha) / a0,
+		}
+	}
+
+	return stages
+}
+
+// integratedLoudness implements the BS.1770 gated loudness measurement.
+//
+// The K-weighted signal power is measured in 400ms blocks with 75% overlap.
+// The blocks below -70 LUFS are ignored, then the blocks that are
+// 10 LU below the average of the remaining ones are ignored too.
+func integratedLoudness(set *SampleSet) float64 {
+	const (
+		absoluteGate = -70.0
+		relativeGate = -10.0
+	)
+
+	sampleRate := float64(set.PerSecond)
+	blockSize := int(0.4 * sampleRate)
+	blockStep := blockSize / 4
+	if blockSize == 0 || len(set.Left) < blockSize {
+		return math.Inf(-1)
+	}
+
+	// Squared K-weighted samples of both channels.
+	power := make([]float64, len(set.Left))
+	for _, channel := range [2][]float32{set.Left, set.Right} {
+		filters := kWeightingFilters(sampleRate)
+		for i, v := range channel {
+			y := filters[1].next(filters[0].next(float64(v)))
+			power[i] += y * y
+		}
+	}
+
+	// A prefix sum makes every block power a single subtraction.
+	prefix := make([]float64, len(power)+1)
+	for i, p := range power {
+		prefix[i+1] = prefix[i] + p
+	}
+	var blocks []float64
+	for from := 0; from+blockSize <= len(power); from += blockStep {
+		blocks = append(blocks, (prefix[from+blockSize]-prefix[from])/float64(blockSize))
+	}
+
+	blockLoudness := func(p float64) float64 {
+		return -0.691 + 10*math.Log10(p)
+	}
+	gatedAverage := func(threshold float64) float64 {
+		sum := 0.0
+		n := 0
+		for _, p := range blocks {
+			if blockLoudness(p) > threshold {
+				sum += p
+				n++
+			}
+		}
+		if n == 0 {
+			return 0
+		}
+		return sum / float64(n)
+	}
+
+	p := gatedAverage(absoluteGate)
+	if p == 0 {
+		return math.Inf(-1)
+	}
+	p = gatedAverage(blockLoudness(p) + relativeGate)
+	if p == 0 {
+		return math.Inf(-1)
+	}
+	return blockLoudness(p)
+}
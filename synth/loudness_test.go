@@ -0,0 +1,121 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func newTestSine(amplitude, freq, seconds float64) *SampleSet {
+	const sampleRate = 44100
+	n := int(seconds * sampleRate)
+	set := &SampleSet{
+		PerSecond: sampleRate,
+		Left:      make([]float32, n),
+		Right:     make([]float32, n),
+	}
+	for i := range set.Left {
+		v := float32(amplitude * math.Sin(2*math.Pi*freq*float64(i)/sampleRate))
+		set.Left[i] = v
+		set.Right[i] = v
+	}
+	return set
+}
+
+func TestAnalyze(t *testing.T) {
+	stats := newTestSine(1, 997, 3).Analyze()
+	if math.Abs(stats.Peak-1) > 1e-3 {
+		t.Fatalf("peak: have %f, want 1", stats.Peak)
+	}
+	if math.Abs(stats.RMS-1/math.Sqrt2) > 1e-3 {
+		t.Fatalf("rms: have %f, want %f", stats.RMS, 1/math.Sqrt2)
+	}
+	// BS.1770: a full scale 997 Hz sine is -3.01 LUFS per channel,
+	// the channel powers are summed.
+	if math.Abs(stats.Loudness) > 0.05 {
+		t.Fatalf("loudness: have %f, want 0", stats.Loudness)
+	}
+	if stats.Clipped != 0 {
+		t.Fatalf("unexpected clipping: %d samples", stats.Clipped)
+	}
+
+	stats = newTestSine(1.5, 997, 1).Analyze()
+	if stats.Clipped == 0 {
+		t.Fatal("clipping is not detected")
+	}
+
+	stats = newTestSine(0, 997, 1).Analyze()
+	if !math.IsInf(stats.Loudness, -1) || stats.PeakDB() != silenceDB {
+		t.Fatalf("silence: loudness=%f peak=%fdB", stats.Loudness, stats.PeakDB())
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		amplitude float64
+		target    float64
+	}{
+		{amplitude: 0.1, target: DefaultLoudness},
+		{amplitude: 0.9, target: DefaultLoudness},
+		{amplitude: 0.9, target: -23},
+	}
+
+	for _, test := range tests {
+		stats := newTestSine(test.amplitude, 440, 2).Normalize(test.target)
+		if math.Abs(stats.Loudness-test.target) > 0.1 {
+			t.Fatalf("%.1f sine: have %f LUFS, want %f", test.amplitude, stats.Loudness, test.target)
+		}
+	}
+
+	// A very quiet track is not amplified beyond the max gain.
+	stats := newTestSine(0.001, 440, 2).Normalize(DefaultLoudness)
+	if stats.Peak > 0.001*maxNormalizationGain*1.001 {
+		t.Fatalf("quiet track peak is %f", stats.Peak)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	// Short loud bursts over a quiet sine.
+	whole := newTestSine(0.3, 440, 2)
+	for i := 10000; i < 10100; i++ {
+		whole.Left[i] += 1.5
+	}
+	for i := 30000; i < 30003; i++ {
+		whole.Right[i] -= 2
+	}
+	chunked := &SampleSet{
+		PerSecond: whole.PerSecond,
+		Left:      append([]float32(nil), whole.Left...),
+		Right:     append([]float32(nil), whole.Right...),
+	}
+
+	l := newLimiter(float64(whole.PerSecond))
+	l.Process(whole.Left, whole.Right, len(whole.Left))
+	if l.stats.Limited != 103 {
+		t.Fatalf("limited samples: have %d, want 103", l.stats.Limited)
+	}
+	if l.stats.InputPeak < 1.79 || l.stats.MaxReduction < 6 {
+		t.Fatalf("unexpected stats: %+v", l.stats)
+	}
+	if peak := whole.Analyze().Peak; peak > limiterCeiling+1e-6 {
+		t.Fatalf("the peak %f is over the ceiling", peak)
+	}
+	// The gain is restored after the bursts.
+	if gain := whole.Left[80000] / chunked.Left[80000]; math.Abs(float64(gain)-1) > 1e-3 {
+		t.Fatalf("the gain is not restored: %f", gain)
+	}
+
+	// The result doesn't depend on the block sizes.
+	l = newLimiter(float64(chunked.PerSecond))
+	for from := 0; from < len(chunked.Left); from += 333 {
+		n := 333
+		if from+n > len(chunked.Left) {
+			n = len(chunked.Left) - from
+		}
+		l.Process(chunked.Left[from:], chunked.Right[from:], n)
+	}
+	for i := range whole.Left {
+		if whole.Left[i] != chunked.Left[i] || whole.Right[i] != chunked.Right[i] {
+			t.Fatalf("sample[%d]: chunked processing result differs", i)
+		}
+	}
+}
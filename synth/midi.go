@@ -0,0 +1,110 @@
+package synth
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"math/bits"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+// Note is a single note played by an instrument.
+type Note struct {
+	Time     float64 `json:"time"`
+	Duration float64 `json:"duration"`
+
+	// Instrument is an instrument slot ID.
+	Instrument int `json:"instrument"`
+
+	Channel  int `json:"channel"`
+	Key      int `json:"key"`
+	Velocity int `json:"velocity"`
+}
+
+const midiTicksPerQuarter = 480
+
+// writeMIDI encodes the events as a single-track Standard MIDI File.
+// The events are expected to be time-ordered.
+//
+// The track tempo and time signature are stored as the meta events,
+// so the notes are aligned to the bars in the MIDI editors.
+func writeMIDI(w io.Writer, events []noteEvent, length float64, tempo synthdb.Tempo) error {
+	var track bytes.Buffer
+
+	// Set tempo meta event: microseconds per quarter note.
+	quarterBPM := tempo.QuarterBPM()
+	usPerQuarter := int(math.Round(60_000_000 / quarterBPM))
+	writeVarInt(&track, 0)
+	track.Write([]byte{0xFF, 0x51, 0x03, byte(usPerQuarter >> 16), byte(usPerQuarter >> 8), byte(usPerQuarter)})
+
+	// Time signature meta event: the denominator is a power of two;
+	// 24 MIDI clocks per metronome click and 8 32nd notes per quarter.
+	writeVarInt(&track, 0)
+	beats, unit := tempo.TimeSignature()
+	track.Write([]byte{0xFF, 0x58, 0x04, byte(beats), byte(bits.TrailingZeros(uint(unit))), 24, 8})
+
+	ticksPerSecond := midiTicksPerQuarter * quarterBPM / 60
+	midiTick := func(t float64) int {
+		return int(math.Round(t * ticksPerSecond))
+	}
+
+	tick := 0
+	for _, e := range events {
+		eventTick := midiTick(e.t)
+		writeVarInt(&track, uint32(eventTick-tick))
+		tick = eventTick
+		channel := byte(e.channel)
+		switch e.kind {
+		case noteOnEvent:
+			track.Write([]byte{0x90 | channel, byte(e.key), byte(e.velocity)})
+		case noteOffEvent:
+			track.Write([]byte{0x80 | channel, byte(e.key), 0})
+		case programChangeEvent:
+			track.Write([]byte{0xC0 | channel, byte(e.value)})
+		case controlChangeEvent:
+			track.Write([]byte{0xB0 | channel, byte(e.controller), byte(e.value)})
+		case pitchBendEvent:
+			track.Write([]byte{0xE0 | channel, byte(e.value & 0x7F), byte(e.value >> 7)})
+		}
+	}
+
+	// End of track meta event.
+	// It's placed at the track end, so the trailing silence is preserved.
+	writeVarInt(&track, uint32(gmath.ClampMin(midiTick(length)-tick, 0)))
+	track.Write([]byte{0xFF, 0x2F, 0x00})
+
+	bw := bufio.NewWriter(w)
+	chunks := []any{
+		[4]byte{'M', 'T', 'h', 'd'},
+		uint32(6),
+		uint16(0), // Format 0: a single multi-channel track
+		uint16(1), // Number of tracks
+		uint16(midiTicksPerQuarter),
+		[4]byte{'M', 'T', 'r', 'k'},
+		uint32(track.Len()),
+		track.Bytes(),
+	}
+	for _, v := range chunks {
+		if err := binary.Write(bw, binary.BigEndian, v); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
+// writeVarInt writes a MIDI variable-length quantity.
+func writeVarInt(buf *bytes.Buffer, v uint32) {
+	var tmp [5]byte
+	i := len(tmp) - 1
+	tmp[i] = byte(v & 0x7F)
+	for v >>= 7; v != 0; v >>= 7 {
+		i--
+		tmp[i] = byte(v&0x7F) | 0x80
+	}
+	buf.Write(tmp[i:])
+}
@@ -0,0 +1,98 @@
+package synth
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+func TestWriteMIDI(t *testing.T) {
+	sf := loadTestSoundFont(t)
+	p, prog := newTestMusicPlayer(t, sf, []testInstrument{
+		{fx: "x", period: "0.5", gate: "0.5"},
+		{fx: "1", period: "1", percussion: true},
+	})
+
+	// 6/8 at 90 BPM is 45 quarter notes per minute: 360 ticks per second.
+	prog.Tempo = synthdb.ParseTempo(90, "6/8", false)
+
+	notes := p.createNotes(prog)
+	events := p.createSequence(prog)
+
+	var buf bytes.Buffer
+	if err := writeMIDI(&buf, events, prog.Length, prog.Tempo); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	if string(data[:4]) != "MThd" || string(data[14:18]) != "MTrk" {
+		t.Fatalf("bad chunk headers: %q", data[:18])
+	}
+	trackLen := binary.BigEndian.Uint32(data[18:22])
+	if int(trackLen) != len(data)-22 {
+		t.Fatalf("track length mismatch: header says %d, have %d", trackLen, len(data)-22)
+	}
+
+	// Decode the track and count the note-on messages per channel.
+	noteOns := map[byte]int{}
+	metaEvents := map[byte][]byte{}
+	track := data[22:]
+	var tick uint32
+	for len(track) != 0 {
+		var delta uint32
+		for {
+			b := track[0]
+			track = track[1:]
+			delta = delta<<7 | uint32(b&0x7F)
+			if b&0x80 == 0 {
+				break
+			}
+		}
+		tick += delta
+		status := track[0]
+		switch {
+		case status == 0xFF:
+			metaEvents[track[1]] = track[3 : 3+int(track[2])]
+			track = track[3+int(track[2]):]
+		case status&0xF0 == 0xC0:
+			track = track[2:]
+		default:
+			if status&0xF0 == 0x90 {
+				noteOns[status&0x0F]++
+			}
+			track = track[3:]
+		}
+	}
+
+	if want := uint32(prog.Length * 360); tick != want {
+		t.Fatalf("track ends at tick %d, want %d", tick, want)
+	}
+	// 1333333 microseconds per quarter note.
+	if have, want := metaEvents[0x51], []byte{0x14, 0x58, 0x55}; !bytes.Equal(have, want) {
+		t.Fatalf("tempo: have % x, want % x", have, want)
+	}
+	if have, want := metaEvents[0x58], []byte{6, 3, 24, 8}; !bytes.Equal(have, want) {
+		t.Fatalf("time signature: have % x, want % x", have, want)
+	}
+	// The last x=3.5 note is out of the playable values range.
+	if noteOns[0] != 6 {
+		t.Fatalf("channel 0: have %d note-on events, want 6", noteOns[0])
+	}
+	if noteOns[midiPercussionChannel] != 3 {
+		t.Fatalf("percussion channel: have %d note-on events, want 3", noteOns[midiPercussionChannel])
+	}
+	if len(notes) != noteOns[0]+noteOns[midiPercussionChannel] {
+		t.Fatalf("have %d notes, want %d", len(notes), noteOns[0]+noteOns[midiPercussionChannel])
+	}
+	for i, n := range notes {
+		if i > 0 && n.Time < notes[i-1].Time {
+			t.Fatalf("notes[%d] is out of order", i)
+		}
+		if n.Instrument == 0 && math.Abs(n.Duration-0.25) > 1e-9 {
+			t.Fatalf("notes[%d]: duration is %f, want 0.25", i, n.Duration)
+		}
+	}
+}
@@ -0,0 +1,564 @@
+package synth
+
+import (
+	"context"
+	"math"
+	"sort"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/synthdb"
+	"github.com/sinshu/go-meltysynth/meltysynth"
+)
+
+type SampleSet struct {
+	PerSecond int
+	Left      []float32
+	Right     []float32
+}
+
+type musicPlayer struct {
+	runner      ProgramRunner
+	sf          *synthdb.SoundFont
+	instruments []*instrument
+	settings    *meltysynth.SynthesizerSettings
+	noteEvents  []noteEvent
+	keysBuf     []int32
+
+	// stems is a per-instrument rendering cache.
+	stems []*stem
+}
+
+type noteEventKind uint8
+
+const (
+	// Note-off events go first, so a note that ends at the
+	// same time as the next one begins doesn't cut it.
+	// Control changes are applied before the note-on events
+	// that they affect.
+	noteOffEvent noteEventKind = iota
+	programChangeEvent
+	controlChangeEvent
+	pitchBendEvent
+	noteOnEvent
+)
+
+type noteEvent struct {
+	t        float64
+	kind     noteEventKind
+	channel  int32
+	key      int32
+	velocity int32
+
+	controller int32
+	value      int32
+}
+
+const (
+	midiBankSelectController    = 0x00
+	midiDataEntryController     = 0x06
+	midiVolumeController        = 0x07
+	midiPanController           = 0x0A
+	midiDataEntryFineController = 0x26
+	midiReverbController        = 0x5B
+	midiChorusController        = 0x5D
+	midiRPNFineController       = 0x64
+	midiRPNCoarseController     = 0x65
+)
+
+// midiPitchBendCenter is a pitch bend value that means "no bend".
+const midiPitchBendCenter = 8192
+
+// midiPercussionChannel is reserved for the drum kits.
+const midiPercussionChannel = 9
+
+const defaultNoteVelocity = 40
+
+// mixGain is the live mix level.
+// The stems are rendered at the full scale, so the mix of a few loud
+// instruments goes over it; the mix limiter takes care of that.
+// The offline renders can be normalized instead, see SampleSet.Normalize.
+const mixGain = 0.75
+
+const (
+	minNoteGate = 0.05
+	maxNoteGate = 2.0
+)
+
+// glideStep is a time resolution of the glide pitch bends.
+const glideStep = 0.01
+
+// MaxGlideRange is the max pitch bend range of the glide mode, in semitones.
+const MaxGlideRange = 24
+
+func newMusicPlayer(sf *synthdb.SoundFont, instruments []*instrument) *musicPlayer {
+	p := &musicPlayer{
+		sf:          sf,
+		instruments: instruments,
+		stems:       make([]*stem, len(instruments)),
+	}
+	p.settings = meltysynth.NewSynthesizerSettings(44100)
+	p.settings.EnableReverbAndChorus = false
+	return p
+}
+
+// createEvents converts the note activations into a time-ordered
+// list of note-on and note-off events.
+//
+// The note duration is defined by the instrument gate:
+// it's a fraction of the instrument period.
+func (p *musicPlayer) createEvents(prog Program, activations []NoteActivation) []noteEvent {
+	type noteID struct {
+		channel int32
+		key     int32
+	}
+
+	events := p.noteEvents[:0]
+	pendingNoteOff := map[noteID]int{}
+	channelPan := map[int32]int32{}
+	glideEnds := glideEndTimes(prog, activations)
+	for i, e := range activations {
+		inst := p.instruments[e.ID]
+		keys := instrumentKeys(p.keysBuf[:0], inst, e.T, inst.compiledFx.Run(e.T), prog.Scale)
+		p.keysBuf = keys
+		if len(keys) == 0 {
+			continue
+		}
+		channel := midiChannel(e.ID, inst.percussion)
+
+		if inst.compiledPan != nil {
+			pan := midiPanValue(inst.compiledPan.Run(e.T))
+			if prevPan, ok := channelPan[channel]; !ok || prevPan != pan {
+				channelPan[channel] = pan
+				events = append(events, noteEvent{
+					t:          e.T,
+					kind:       controlChangeEvent,
+					channel:    channel,
+					controller: midiPanController,
+					value:      pan,
+				})
+			}
+		}
+
+		gate := 1.0
+		if inst.compiledGate != nil {
+			gate = gmath.Clamp(inst.compiledGate.Run(e.T), minNoteGate, maxNoteGate)
+		}
+		offTime := e.T + gate*e.Period
+
+		if inst.glideRange != 0 && !inst.percussion {
+			glideEnd := math.Min(offTime, glideEnds[i])
+			events = appendGlideEvents(events, inst, channel, keys[0], e.T, glideEnd)
+		}
+
+		// A chord is played as several notes with the same timings.
+		for _, key := range keys {
+			// The same key can't sound twice on one channel.
+			// If the previous note is still playing, it ends right before
+			// the new one starts.
+			id := noteID{channel: channel, key: key}
+			if offIndex, ok := pendingNoteOff[id]; ok && events[offIndex].t > e.T {
+				events[offIndex].t = e.T
+			}
+
+			events = append(events, noteEvent{
+				t:        e.T,
+				kind:     noteOnEvent,
+				channel:  channel,
+				key:      key,
+				velocity: inst.velocity,
+			})
+
+			if offTime >= prog.Length {
+				delete(pendingNoteOff, id)
+				continue
+			}
+			pendingNoteOff[id] = len(events)
+			events = append(events, noteEvent{
+				t:       offTime,
+				kind:    noteOffEvent,
+				channel: channel,
+				key:     key,
+			})
+		}
+	}
+
+	sortNoteEvents(events)
+
+	p.noteEvents = events
+	return events
+}
+
+func sortNoteEvents(events []noteEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].t == events[j].t {
+			return events[i].kind < events[j].kind
+		}
+		return events[i].t < events[j].t
+	})
+}
+
+// instrumentKey maps the instrument function value to a MIDI key.
+// For the drum kits, the key selects a drum sound.
+func instrumentKey(inst *instrument, y float64, scale synthdb.Scale) (int32, bool) {
+	if inst.percussion {
+		return synthdb.DrumForValue(y)
+	}
+	key, ok := synthdb.NoteForValue(y, scale)
+	if !ok {
+		return 0, false
+	}
+	return fitKeyRange(key, inst.keyRange), true
+}
+
+// glideEndTimes returns the time of the next activation of the same
+// instrument for every activation; it's the program length for the last one.
+// A glide note controls the channel pitch until the next note begins.
+func glideEndTimes(prog Program, activations []NoteActivation) []float64 {
+	ends := make([]float64, len(activations))
+	next := map[int]float64{}
+	for i := len(activations) - 1; i >= 0; i-- {
+		e := activations[i]
+		ends[i] = prog.Length
+		if t, ok := next[e.ID]; ok {
+			ends[i] = t
+		}
+		next[e.ID] = e.T
+	}
+	return ends
+}
+
+// appendGlideEvents adds the pitch bends that make the note
+// follow the instrument function between from and to.
+//
+// The function value is not snapped to the scale;
+// the bends are relative to the played key (a chord root).
+// Where the function can't be played, the last bend is kept.
+func appendGlideEvents(events []noteEvent, inst *instrument, channel, key int32, from, to float64) []noteEvent {
+	// The key can be transposed by octaves to fit the preset key range,
+	// the glide pitch is transposed the same way.
+	pitch, ok := synthdb.PitchForValue(inst.compiledFx.Run(from))
+	if !ok {
+		return events
+	}
+	shift := 12 * math.Round((float64(key)-pitch)/12)
+
+	prevValue := int32(-1)
+	for i := 0; ; i++ {
+		t := from + float64(i)*glideStep
+		if t >= to {
+			break
+		}
+		pitch, ok := synthdb.PitchForValue(inst.compiledFx.Run(t))
+		if !ok {
+			continue
+		}
+		value := pitchBendValue(pitch+shift-float64(key), inst.glideRange)
+		if value == prevValue {
+			continue
+		}
+		prevValue = value
+		events = append(events, noteEvent{
+			t:       t,
+			kind:    pitchBendEvent,
+			channel: channel,
+			value:   value,
+		})
+	}
+	return events
+}
+
+// pitchBendValue maps the bend in semitones to a MIDI pitch bend value.
+func pitchBendValue(semitones float64, bendRange int32) int32 {
+	v := midiPitchBendCenter + math.Round(semitones/float64(bendRange)*midiPitchBendCenter)
+	return int32(gmath.Clamp(v, 0, 2*midiPitchBendCenter-1))
+}
+
+// chordStackSize is the number of notes in a chord
+// defined by the chord function.
+const chordStackSize = 3
+
+// instrumentKeys appends the keys played by the instrument activation at t.
+//
+// A chord root is fitted into the preset key range,
+// the other chord notes are built on top of it.
+// The chord function result is an interval in semitones
+// between the stacked chord notes.
+func instrumentKeys(dst []int32, inst *instrument, t, y float64, scale synthdb.Scale) []int32 {
+	key, ok := instrumentKey(inst, y, scale)
+	if !ok {
+		return dst
+	}
+	if inst.percussion {
+		return append(dst, key)
+	}
+	chord := inst.chord
+	if inst.compiledChord != nil {
+		interval := inst.compiledChord.Run(t)
+		if math.IsNaN(interval) {
+			return append(dst, key)
+		}
+		chord = synthdb.StackedChord(int32(gmath.Clamp(math.Round(interval), 1, 12)), chordStackSize)
+	}
+	return chord.Keys(dst, key, scale)
+}
+
+// fitKeyRange transposes the key by octaves until it fits the preset key range.
+// The scale degree is preserved unless the range is narrower than an octave.
+func fitKeyRange(key int32, keyRange [2]int32) int32 {
+	if keyRange[1]-keyRange[0] < 11 {
+		return clampInt32(key, keyRange[0], keyRange[1])
+	}
+	for key < keyRange[0] {
+		key += 12
+	}
+	for key > keyRange[1] {
+		key -= 12
+	}
+	return key
+}
+
+// midiChannel allocates a MIDI channel for the instrument.
+// The melodic instruments use their IDs as channels,
+// skipping the percussion channel.
+func midiChannel(id int, percussion bool) int32 {
+	switch {
+	case percussion:
+		return midiPercussionChannel
+	case id >= midiPercussionChannel:
+		return int32(id) + 1
+	default:
+		return int32(id)
+	}
+}
+
+func clampInt32(v, min, max int32) int32 {
+	switch {
+	case v < min:
+		return min
+	case v > max:
+		return max
+	default:
+		return v
+	}
+}
+
+// midiPanValue maps [-1, 1] pan value to [0, 127] MIDI controller value.
+func midiPanValue(pan float64) int32 {
+	if math.IsNaN(pan) {
+		return 64
+	}
+	return int32(math.Round((gmath.Clamp(pan, -1, 1) + 1) * 63.5))
+}
+
+func midiSendValue(send float64) int32 {
+	return int32(math.Round(127 * send))
+}
+
+// getStem returns the instrument stem for the given program.
+// A cached stem is reused if the instrument synthesis settings are unchanged.
+//
+// With a speed below 1, the notes are stretched in time.
+func (p *musicPlayer) getStem(prog Program, progInst ProgramInstrument, speed float64) *stem {
+	inst := p.instruments[progInst.ID]
+	// The speed changes the stem length, so it's a part of the key.
+	length := p.streamLength(prog, speed)
+	key := newStemKey(inst, prog, length)
+	if cached := p.stems[progInst.ID]; cached != nil && cached.key == key {
+		return cached
+	}
+
+	backend := p.newBackend(inst.reverbSend != 0 || inst.chorusSend != 0)
+
+	// The stem is rendered at the max volume, see stemGain.
+	setup := p.setupEvents(progInst.ID, 127)
+	events := p.createInstrumentEvents(prog, progInst)
+	if speed != 1 {
+		for i := range events {
+			events[i].t /= speed
+		}
+	}
+	s := newStem(key, newNoteRenderer(backend, setup, events, length))
+	p.stems[progInst.ID] = s
+	return s
+}
+
+// setupEvents returns the events that configure the instrument channel.
+func (p *musicPlayer) setupEvents(id int, volume int32) []noteEvent {
+	inst := p.instruments[id]
+	channel := midiChannel(id, inst.percussion)
+	// The percussion channel implies the drum kits bank.
+	var bank int32
+	if !inst.percussion {
+		bank = inst.bank
+	}
+	events := []noteEvent{
+		{kind: controlChangeEvent, channel: channel, controller: midiBankSelectController, value: bank},
+		{kind: programChangeEvent, channel: channel, value: inst.patchNumber},
+		{kind: controlChangeEvent, channel: channel, controller: midiVolumeController, value: volume},
+		{kind: controlChangeEvent, channel: channel, controller: midiReverbController, value: midiSendValue(inst.reverbSend)},
+		{kind: controlChangeEvent, channel: channel, controller: midiChorusController, value: midiSendValue(inst.chorusSend)},
+	}
+	if inst.glideRange != 0 && !inst.percussion {
+		// RPN 0 sets the pitch bend range, the null RPN
+		// protects it from the stray data entry messages.
+		events = append(events,
+			noteEvent{kind: controlChangeEvent, channel: channel, controller: midiRPNCoarseController, value: 0},
+			noteEvent{kind: controlChangeEvent, channel: channel, controller: midiRPNFineController, value: 0},
+			noteEvent{kind: controlChangeEvent, channel: channel, controller: midiDataEntryController, value: inst.glideRange},
+			noteEvent{kind: controlChangeEvent, channel: channel, controller: midiDataEntryFineController, value: 0},
+			noteEvent{kind: controlChangeEvent, channel: channel, controller: midiRPNCoarseController, value: 127},
+			noteEvent{kind: controlChangeEvent, channel: channel, controller: midiRPNFineController, value: 127},
+		)
+	}
+	return events
+}
+
+// createInstrumentEvents is like createEvents, but only the
+// given instrument notes are included.
+// The result is only valid until the next createEvents call.
+func (p *musicPlayer) createInstrumentEvents(prog Program, progInst ProgramInstrument) []noteEvent {
+	instProg := prog
+	instProg.Instruments = []ProgramInstrument{progInst}
+	return p.createEvents(instProg, p.runner.RunProgram(instProg))
+}
+
+// createSequence returns all program events as they're heard in the mix:
+// the setup events go first, followed by the time-ordered note events.
+//
+// Unlike the stems, the volume is set by the channel controller.
+func (p *musicPlayer) createSequence(prog Program) []noteEvent {
+	var events []noteEvent
+	for _, progInst := range prog.Instruments {
+		events = append(events, p.setupEvents(progInst.ID, p.instruments[progInst.ID].mappedVolume)...)
+	}
+	numSetupEvents := len(events)
+	for _, progInst := range prog.Instruments {
+		events = append(events, p.createInstrumentEvents(prog, progInst)...)
+	}
+	sortNoteEvents(events[numSetupEvents:])
+	return events
+}
+
+// createNotes returns all program notes ordered by their start time.
+func (p *musicPlayer) createNotes(prog Program) []Note {
+	var notes []Note
+	for _, progInst := range prog.Instruments {
+		// Every key has at most one pending note, see createEvents.
+		pending := map[int32]int{}
+		for _, e := range p.createInstrumentEvents(prog, progInst) {
+			switch e.kind {
+			case noteOnEvent:
+				pending[e.key] = len(notes)
+				notes = append(notes, Note{
+					Time:       e.t,
+					Duration:   prog.Length - e.t,
+					Instrument: progInst.ID,
+					Channel:    int(e.channel),
+					Key:        int(e.key),
+					Velocity:   int(e.velocity),
+				})
+			case noteOffEvent:
+				if i, ok := pending[e.key]; ok {
+					notes[i].Duration = e.t - notes[i].Time
+					delete(pending, e.key)
+				}
+			}
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].Time < notes[j].Time
+	})
+	return notes
+}
+
+// newBackend creates a synthesizer for the current sound font.
+// The fonts without the SF2 data are played by the oscillator synth.
+func (p *musicPlayer) newBackend(effects bool) SynthBackend {
+	if p.sf.Data == nil {
+		return newOscillatorSynth(int(p.settings.SampleRate))
+	}
+	p.settings.EnableReverbAndChorus = effects
+	return newMeltysynthBackend(p.sf.Data, p.settings)
+}
+
+// streamLength returns the number of the program samples
+// when it's played with the given speed.
+func (p *musicPlayer) streamLength(prog Program, speed float64) int {
+	return int(prog.Length / speed * float64(p.settings.SampleRate))
+}
+
+// newMixer creates a mixer for the selected program instruments.
+func (p *musicPlayer) newMixer(prog Program, instruments []ProgramInstrument, speed float64) *stemMixer {
+	m := &stemMixer{
+		stems:      make([]*stem, len(instruments)),
+		ids:        make([]int, len(instruments)),
+		gains:      make([]float32, len(instruments)),
+		gain:       1,
+		sampleRate: float64(p.settings.SampleRate),
+		length:     p.streamLength(prog, speed),
+	}
+	for i, progInst := range instruments {
+		m.stems[i] = p.getStem(prog, progInst, speed)
+		m.ids[i] = progInst.ID
+		m.gains[i] = stemGain(p.instruments[progInst.ID].mappedVolume)
+	}
+	return m
+}
+
+func (p *musicPlayer) createPCM(ctx context.Context, prog Program, progress func(float64)) (*SampleSet, error) {
+	return renderMixer(ctx, p.newLiveMixer(prog, 1), progress)
+}
+
+// renderMixer renders all mixer samples.
+//
+// The samples are rendered in 0.5 second chunks to report the progress
+// in [0, 1] range and to abort the rendering if the context is cancelled.
+func renderMixer(ctx context.Context, m *stemMixer, progress func(float64)) (*SampleSet, error) {
+	stream := newSampleStream(m)
+	chunkSize := int(m.sampleRate / 2)
+	for offset := 0; offset < m.length; offset += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(float64(offset) / float64(m.length))
+		}
+		if err := stream.skip(gmath.ClampMax(chunkSize, m.length-offset)); err != nil {
+			return nil, err
+		}
+	}
+	if progress != nil {
+		progress(1)
+	}
+	return stream.Samples(), nil
+}
+
+func (p *musicPlayer) createStream(prog Program, speed float64) *SampleStream {
+	return newSampleStream(p.newLiveMixer(prog, speed))
+}
+
+// newLiveMixer creates a limited mixer for all program instruments.
+// Unlike the normalized mix, it doesn't need the entire track to be
+// rendered beforehand, so it's suitable for the playback.
+func (p *musicPlayer) newLiveMixer(prog Program, speed float64) *stemMixer {
+	m := p.newMixer(prog, prog.Instruments, speed)
+	m.gain = mixGain
+	m.limiter = newLimiter(m.sampleRate)
+	return m
+}
+
+func (p *musicPlayer) createExport(prog Program) *TrackExport {
+	e := &TrackExport{
+		Manifest: ExportManifest{
+			SampleRate: int(p.settings.SampleRate),
+			Length:     prog.Length,
+			Mix:        "mix.wav",
+		},
+		mix:   p.newMixer(prog, prog.Instruments, 1),
+		stems: make([]*stemMixer, len(prog.Instruments)),
+	}
+	for i := range prog.Instruments {
+		e.stems[i] = p.newMixer(prog, prog.Instruments[i:i+1], 1)
+	}
+	return e
+}
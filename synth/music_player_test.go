@@ -0,0 +1,477 @@
+package synth
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/synthdb"
+	"github.com/quasilyte/sinecord/synthdb/sf2test"
+	"github.com/sinshu/go-meltysynth/meltysynth"
+)
+
+type testInstrument struct {
+	fx         string
+	gate       string
+	pan        string
+	period     string
+	chord      string
+	glide      int32
+	percussion bool
+}
+
+func loadTestSoundFont(t *testing.T) *synthdb.SoundFont {
+	t.Helper()
+
+	// The generated fixture is used if the real font is not available.
+	name := "TimGM6mb"
+	data, err := os.ReadFile("../assets/_data/raw/TimGM6mb.sf2")
+	if err != nil {
+		name = "sf2test"
+		data = sf2test.Generate(sf2test.GM())
+	}
+	sf, err := meltysynth.NewSoundFont(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &synthdb.SoundFont{Name: name, Data: sf}
+}
+
+func newTestMusicPlayer(t *testing.T, sf *synthdb.SoundFont, instruments []testInstrument) (*musicPlayer, Program) {
+	t.Helper()
+
+	prog := Program{Length: 4}
+	list := make([]*instrument, len(instruments))
+	for i, testInst := range instruments {
+		fx, err := exprc.Compile(testInst.fx)
+		if err != nil {
+			t.Fatalf("compile %q: %v", testInst.fx, err)
+		}
+		period, err := exprc.Compile(testInst.period)
+		if err != nil {
+			t.Fatalf("compile %q: %v", testInst.period, err)
+		}
+		inst := newInstrument()
+		inst.fx = testInst.fx
+		inst.compiledFx = fx
+		inst.periodFunc = testInst.period
+		inst.compiledPeriod = period
+		inst.enabled = true
+		inst.percussion = testInst.percussion
+		if testInst.gate != "" {
+			gate, err := exprc.Compile(testInst.gate)
+			if err != nil {
+				t.Fatalf("compile %q: %v", testInst.gate, err)
+			}
+			inst.compiledGate = gate
+		}
+		if testInst.pan != "" {
+			pan, err := exprc.Compile(testInst.pan)
+			if err != nil {
+				t.Fatalf("compile %q: %v", testInst.pan, err)
+			}
+			inst.compiledPan = pan
+		}
+		if chord, ok := synthdb.ParseChord(testInst.chord); ok {
+			inst.chord = chord
+		} else {
+			compiled, err := exprc.Compile(testInst.chord)
+			if err != nil {
+				t.Fatalf("compile %q: %v", testInst.chord, err)
+			}
+			inst.compiledChord = compiled
+		}
+		inst.chordFunc = testInst.chord
+		inst.glideRange = testInst.glide
+		list[i] = inst
+		prog.Instruments = append(prog.Instruments, ProgramInstrument{
+			ID:     i,
+			Index:  i,
+			Func:   fx,
+			Period: period,
+		})
+	}
+	return newMusicPlayer(sf, list), prog
+}
+
+func renderTestPCM(t *testing.T, p *musicPlayer, prog Program) *SampleSet {
+	t.Helper()
+	samples, err := p.createPCM(context.Background(), prog, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return samples
+}
+
+func TestCreateEvents(t *testing.T) {
+	type eventInfo struct {
+		t       float64
+		kind    noteEventKind
+		channel int32
+		key     int32
+		value   int32
+	}
+
+	tests := []struct {
+		name        string
+		instruments []testInstrument
+		events      []eventInfo
+	}{
+		{
+			name: "default gate",
+			instruments: []testInstrument{
+				{fx: "0", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOffEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 3, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+			},
+		},
+		{
+			name: "staccato",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.25", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 1.25, kind: noteOffEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2.25, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+				{t: 3.25, kind: noteOffEvent, key: 36},
+			},
+		},
+		{
+			name: "gate formula",
+			instruments: []testInstrument{
+				{fx: "0", gate: "x/4", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 1.25, kind: noteOffEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2.5, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+				{t: 3.75, kind: noteOffEvent, key: 36},
+			},
+		},
+		{
+			name: "gate is clamped",
+			instruments: []testInstrument{
+				{fx: "0", gate: "-1", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 1.05, kind: noteOffEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2.05, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+				{t: 3.05, kind: noteOffEvent, key: 36},
+			},
+		},
+		{
+			name: "legato with different keys",
+			instruments: []testInstrument{
+				{fx: "x-1", gate: "1.5", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 52},
+				{t: 2.5, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 68},
+				{t: 3.5, kind: noteOffEvent, key: 52},
+			},
+		},
+		{
+			name: "legato with the same key",
+			instruments: []testInstrument{
+				{fx: "0", gate: "1.5", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOffEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 3, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+			},
+		},
+		{
+			name: "merged timelines",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "1"},
+				{fx: "3", gate: "0.5", period: "1.5"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, channel: 0, key: 36},
+				{t: 1.5, kind: noteOffEvent, channel: 0, key: 36},
+				{t: 1.5, kind: noteOnEvent, channel: 1, key: 84},
+				{t: 2, kind: noteOnEvent, channel: 0, key: 36},
+				{t: 2.25, kind: noteOffEvent, channel: 1, key: 84},
+				{t: 2.5, kind: noteOffEvent, channel: 0, key: 36},
+				{t: 3, kind: noteOnEvent, channel: 0, key: 36},
+				{t: 3, kind: noteOnEvent, channel: 1, key: 84},
+				{t: 3.5, kind: noteOffEvent, channel: 0, key: 36},
+				{t: 3.75, kind: noteOffEvent, channel: 1, key: 84},
+			},
+		},
+		{
+			name: "variable period",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "x+1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+			},
+		},
+		{
+			name: "pan formula",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", pan: "min(x-2, 0)", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: controlChangeEvent, value: 0},
+				{t: 1, kind: noteOnEvent, key: 36},
+				{t: 1.5, kind: noteOffEvent, key: 36},
+				{t: 2, kind: controlChangeEvent, value: 64},
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2.5, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOnEvent, key: 36},
+				{t: 3.5, kind: noteOffEvent, key: 36},
+			},
+		},
+		{
+			name: "drum kit",
+			instruments: []testInstrument{
+				{fx: "x", gate: "0.5", period: "1", percussion: true},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, channel: 9, key: 47},
+				{t: 1.5, kind: noteOffEvent, channel: 9, key: 47},
+				{t: 2, kind: noteOnEvent, channel: 9, key: 42},
+				{t: 2.5, kind: noteOffEvent, channel: 9, key: 42},
+				{t: 3, kind: noteOnEvent, channel: 9, key: 49},
+				{t: 3.5, kind: noteOffEvent, channel: 9, key: 49},
+			},
+		},
+		{
+			name: "triad",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "2", chord: "triad"},
+			},
+			events: []eventInfo{
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 40},
+				{t: 2, kind: noteOnEvent, key: 43},
+				{t: 3, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOffEvent, key: 40},
+				{t: 3, kind: noteOffEvent, key: 43},
+			},
+		},
+		{
+			name: "custom chord",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "2", chord: "0, 12, 12"},
+			},
+			events: []eventInfo{
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 48},
+				{t: 3, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOffEvent, key: 48},
+			},
+		},
+		{
+			name: "chord function",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "2", chord: "x*2"},
+			},
+			events: []eventInfo{
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 40},
+				{t: 2, kind: noteOnEvent, key: 44},
+				{t: 3, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOffEvent, key: 40},
+				{t: 3, kind: noteOffEvent, key: 44},
+			},
+		},
+		{
+			// A single number is a constant chord function.
+			name: "constant chord function",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "2", chord: "7"},
+			},
+			events: []eventInfo{
+				{t: 2, kind: noteOnEvent, key: 36},
+				{t: 2, kind: noteOnEvent, key: 43},
+				{t: 2, kind: noteOnEvent, key: 50},
+				{t: 3, kind: noteOffEvent, key: 36},
+				{t: 3, kind: noteOffEvent, key: 43},
+				{t: 3, kind: noteOffEvent, key: 50},
+			},
+		},
+		{
+			name: "drum kit chord",
+			instruments: []testInstrument{
+				{fx: "0", gate: "0.5", period: "2", chord: "triad", percussion: true},
+			},
+			events: []eventInfo{
+				{t: 2, kind: noteOnEvent, channel: 9, key: 36},
+				{t: 3, kind: noteOffEvent, channel: 9, key: 36},
+			},
+		},
+		{
+			name: "out of range notes",
+			instruments: []testInstrument{
+				{fx: "x*2", gate: "0.5", period: "1"},
+			},
+			events: []eventInfo{
+				{t: 1, kind: noteOnEvent, key: 68},
+				{t: 1.5, kind: noteOffEvent, key: 68},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			p, prog := newTestMusicPlayer(t, nil, test.instruments)
+			events := p.createEvents(prog, p.runner.RunProgram(prog))
+			if len(events) != len(test.events) {
+				t.Fatalf("expected %d events, got %d:\n%v", len(test.events), len(events), events)
+			}
+			for i, e := range events {
+				have := eventInfo{t: e.t, kind: e.kind, channel: e.channel, key: e.key, value: e.value}
+				want := test.events[i]
+				if math.Abs(have.t-want.t) < 1e-9 {
+					have.t = want.t
+				}
+				if have != want {
+					t.Fatalf("event[%d] mismatch:\nhave: %+v\nwant: %+v", i, have, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGlideEvents(t *testing.T) {
+	p, prog := newTestMusicPlayer(t, nil, []testInstrument{
+		{fx: "x/3", gate: "0.5", period: "2", glide: 12},
+		{fx: "x/3", gate: "0.5", period: "2"},
+	})
+
+	setup := p.setupEvents(0, 100)
+	dataEntry := setup[len(setup)-4]
+	if dataEntry.controller != midiDataEntryController || dataEntry.value != 12 {
+		t.Fatalf("the bend range is not set: %+v", dataEntry)
+	}
+	if len(p.setupEvents(1, 100)) != len(setup)-6 {
+		t.Fatal("unexpected RPN events for a non-glide instrument")
+	}
+
+	events := p.createEvents(prog, p.runner.RunProgram(prog))
+	var key int32
+	numBends := 0
+	prevBend := int32(-1)
+	for _, e := range events {
+		switch e.kind {
+		case noteOnEvent:
+			if e.channel == 0 {
+				if numBends == 0 {
+					t.Fatal("the note-on precedes the pitch bend")
+				}
+				key = e.key
+			}
+		case pitchBendEvent:
+			if e.channel != 0 {
+				t.Fatalf("unexpected pitch bend: %+v", e)
+			}
+			if e.t < 2 || e.t >= 3 {
+				t.Fatalf("the pitch bend is out of the note: t=%f", e.t)
+			}
+			if e.value <= prevBend {
+				t.Fatalf("t=%f: the rising pitch bend goes down: %d", e.t, e.value)
+			}
+			prevBend = e.value
+			numBends++
+		}
+	}
+	if key == 0 {
+		t.Fatal("the glide note is not played")
+	}
+	if numBends < 50 {
+		t.Fatalf("too few pitch bends: %d", numBends)
+	}
+
+	// The last bend matches the function value at the note end.
+	pitch, _ := synthdb.PitchForValue((3 - glideStep) / 3)
+	semitones := float64(prevBend-midiPitchBendCenter) / midiPitchBendCenter * 12
+	if math.Abs(float64(key)+semitones-pitch) > 0.01 {
+		t.Fatalf("the final pitch is %f, want %f", float64(key)+semitones, pitch)
+	}
+}
+
+func TestPanEnergy(t *testing.T) {
+	sf := loadTestSoundFont(t)
+
+	tests := []struct {
+		pan         string
+		minLeftPart float64
+		maxLeftPart float64
+	}{
+		{pan: "-1", minLeftPart: 0.99, maxLeftPart: 1},
+		{pan: "1", minLeftPart: 0, maxLeftPart: 0.01},
+		{pan: "0", minLeftPart: 0.4, maxLeftPart: 0.6},
+		{pan: "", minLeftPart: 0.4, maxLeftPart: 0.6},
+	}
+
+	for _, test := range tests {
+		p, prog := newTestMusicPlayer(t, sf, []testInstrument{
+			{fx: "sin(x)+1", pan: test.pan, period: "0.5"},
+		})
+		p.instruments[0].mappedVolume = 127
+		samples := renderTestPCM(t, p, prog)
+		leftEnergy := 0.0
+		rightEnergy := 0.0
+		for i := range samples.Left {
+			leftEnergy += float64(samples.Left[i]) * float64(samples.Left[i])
+			rightEnergy += float64(samples.Right[i]) * float64(samples.Right[i])
+		}
+		if leftEnergy+rightEnergy == 0 {
+			t.Fatalf("pan=%q: silent output", test.pan)
+		}
+		leftPart := leftEnergy / (leftEnergy + rightEnergy)
+		if leftPart < test.minLeftPart || leftPart > test.maxLeftPart {
+			t.Fatalf("pan=%q: left channel energy part is %.3f, expected [%.2f, %.2f]",
+				test.pan, leftPart, test.minLeftPart, test.maxLeftPart)
+		}
+	}
+}
+
+func TestFitKeyRange(t *testing.T) {
+	tests := []struct {
+		key      int32
+		keyRange [2]int32
+		want     int32
+	}{
+		{key: 60, keyRange: [2]int32{0, 127}, want: 60},
+		{key: 36, keyRange: [2]int32{48, 72}, want: 48},
+		{key: 41, keyRange: [2]int32{48, 72}, want: 53},
+		{key: 83, keyRange: [2]int32{48, 72}, want: 71},
+		{key: 36, keyRange: [2]int32{60, 64}, want: 60},
+		{key: 70, keyRange: [2]int32{60, 64}, want: 64},
+	}
+
+	for _, test := range tests {
+		have := fitKeyRange(test.key, test.keyRange)
+		if have != test.want {
+			t.Errorf("fitKeyRange(%d, %v): have %d, want %d", test.key, test.keyRange, have, test.want)
+		}
+	}
+}
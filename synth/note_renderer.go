@@ -0,0 +1,109 @@
+package synth
+
+// noteRenderer turns the note events into the PCM samples.
+//
+// The samples can be rendered in chunks of an arbitrary size:
+// every event is applied exactly at its sample offset,
+// so the chunk boundaries don't affect the output.
+type noteRenderer struct {
+	synth SynthBackend
+
+	setup  []noteEvent
+	events []noteEvent
+
+	sampleRate float64
+
+	// length is a total number of samples to be rendered.
+	length int
+
+	// pos is a number of samples rendered so far.
+	pos int
+
+	eventIndex int
+}
+
+func newNoteRenderer(synth SynthBackend, setup, events []noteEvent, length int) *noteRenderer {
+	r := &noteRenderer{
+		synth:      synth,
+		setup:      setup,
+		events:     make([]noteEvent, len(events)),
+		sampleRate: float64(synth.SampleRate()),
+		length:     length,
+	}
+	copy(r.events, events)
+	r.applyEvents(r.setup)
+	return r
+}
+
+// Reset rewinds the renderer to the beginning.
+func (r *noteRenderer) Reset() {
+	r.synth.Reset()
+	r.pos = 0
+	r.eventIndex = 0
+	r.applyEvents(r.setup)
+}
+
+func (r *noteRenderer) IsDone() bool {
+	return r.pos >= r.length
+}
+
+// Render fills the left and right buffers with the next samples.
+// It returns the number of samples rendered,
+// it's less than len(left) only when the end is reached.
+func (r *noteRenderer) Render(left, right []float32) int {
+	n := len(left)
+	if remaining := r.length - r.pos; n > remaining {
+		n = remaining
+	}
+	end := r.pos + n
+
+	written := 0
+	for r.pos < end {
+		for r.eventIndex < len(r.events) {
+			e := r.events[r.eventIndex]
+			if r.eventOffset(e) > r.pos {
+				break
+			}
+			r.applyEvent(e)
+			r.eventIndex++
+		}
+
+		blockEnd := end
+		if r.eventIndex < len(r.events) {
+			if offset := r.eventOffset(r.events[r.eventIndex]); offset < blockEnd {
+				blockEnd = offset
+			}
+		}
+		blockSize := blockEnd - r.pos
+		r.synth.Render(left[written:written+blockSize], right[written:written+blockSize])
+		written += blockSize
+		r.pos = blockEnd
+	}
+
+	return n
+}
+
+func (r *noteRenderer) eventOffset(e noteEvent) int {
+	return int(r.sampleRate * e.t)
+}
+
+func (r *noteRenderer) applyEvents(events []noteEvent) {
+	for _, e := range events {
+		r.applyEvent(e)
+	}
+}
+
+func (r *noteRenderer) applyEvent(e noteEvent) {
+	switch e.kind {
+	case noteOnEvent:
+		r.synth.NoteOn(e.channel, e.key, e.velocity)
+	case noteOffEvent:
+		r.synth.NoteOff(e.channel, e.key)
+	case programChangeEvent:
+		r.synth.ProgramChange(e.channel, e.value)
+	case controlChangeEvent:
+		r.synth.ControlChange(e.channel, e.controller, e.value)
+	case pitchBendEvent:
+		r.synth.PitchBend(e.channel, e.value)
+	}
+}
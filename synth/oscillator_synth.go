@@ -0,0 +1,296 @@
+package synth
+
+import (
+	"math"
+)
+
+type oscWaveform int
+
+const (
+	oscSine oscWaveform = iota
+	oscSaw
+	oscSquare
+	oscNoise
+)
+
+// oscPreset is an oscillator synth patch.
+// The envelope times are in seconds, sustain is a level in [0, 1].
+type oscPreset struct {
+	waveform oscWaveform
+
+	attack  float64
+	decay   float64
+	sustain float64
+	release float64
+
+	// cutoff is a low-pass filter cutoff frequency
+	// relative to the note frequency.
+	cutoff float64
+}
+
+// oscPresets are indexed by the patch numbers, see synthdb.Chiptune.
+var oscPresets = []oscPreset{
+	{waveform: oscSine, attack: 0.005, decay: 0.4, sustain: 0, release: 0.2, cutoff: 16},
+	{waveform: oscSaw, attack: 0.005, decay: 0.2, sustain: 0.6, release: 0.1, cutoff: 3},
+	{waveform: oscSquare, attack: 0.01, decay: 0.1, sustain: 0.7, release: 0.1, cutoff: 8},
+	{waveform: oscSaw, attack: 0.15, decay: 0.2, sustain: 0.8, release: 0.3, cutoff: 5},
+	{waveform: oscSquare, attack: 0.05, decay: 0.2, sustain: 0.6, release: 0.15, cutoff: 4},
+	{waveform: oscNoise, attack: 0.001, decay: 0.15, sustain: 0, release: 0.05, cutoff: 20},
+}
+
+const (
+	oscMaxVoices = 32
+
+	// oscMasterVolume leaves some headroom for the overlapping notes.
+	oscMasterVolume = 0.25
+)
+
+// oscillatorSynth is a small subtractive synthesizer:
+// an oscillator, an ADSR envelope and a one-pole low-pass filter per voice.
+//
+// It doesn't need a sound font, is fully deterministic
+// and is much faster than a sample-based synthesizer.
+type oscillatorSynth struct {
+	sampleRate int
+
+	channels [16]oscChannel
+
+	voices []*oscVoice
+
+	noiseSeed uint32
+}
+
+type oscChannel struct {
+	patchNumber int32
+	volume      int32
+	pan         int32
+
+	// rpn is a selected registered parameter number.
+	rpn int32
+
+	// bendRange is in semitones, bend is in [-1, 1] range.
+	bendRange float64
+	bend      float64
+}
+
+// oscNullRPN is a "no parameter selected" RPN value.
+const oscNullRPN = 0x3FFF
+
+// frequencyFactor returns the channel pitch bend frequency multiplier.
+func (ch *oscChannel) frequencyFactor() float64 {
+	if ch.bend == 0 {
+		return 1
+	}
+	return math.Pow(2, ch.bend*ch.bendRange/12)
+}
+
+type envelopeStage int
+
+const (
+	envelopeAttack envelopeStage = iota
+	envelopeDecay
+	envelopeSustain
+	envelopeRelease
+	envelopeDone
+)
+
+type oscVoice struct {
+	channel int32
+	key     int32
+	preset  *oscPreset
+
+	phase         float64
+	phaseStep     float64
+	basePhaseStep float64
+	gain          float64
+
+	stage        envelopeStage
+	level        float64
+	releaseLevel float64
+	stageTime    float64
+
+	filterState float64
+	filterCoeff float64
+
+	noise uint32
+}
+
+func newOscillatorSynth(sampleRate int) *oscillatorSynth {
+	s := &oscillatorSynth{
+		sampleRate: sampleRate,
+		voices:     make([]*oscVoice, 0, oscMaxVoices),
+	}
+	s.Reset()
+	return s
+}
+
+func (s *oscillatorSynth) SampleRate() int { return s.sampleRate }
+
+func (s *oscillatorSynth) Reset() {
+	for i := range s.channels {
+		s.channels[i] = oscChannel{volume: 100, pan: 64, rpn: oscNullRPN, bendRange: 2}
+	}
+	s.voices = s.voices[:0]
+	s.noiseSeed = 0x9e3779b9
+}
+
+func (s *oscillatorSynth) ProgramChange(channel, patchNumber int32) {
+	s.channels[channel].patchNumber = patchNumber
+}
+
+func (s *oscillatorSynth) ControlChange(channel, controller, value int32) {
+	switch controller {
+	case midiVolumeController:
+		s.channels[channel].volume = value
+	case midiPanController:
+		s.channels[channel].pan = value
+	case midiRPNCoarseController:
+		ch := &s.channels[channel]
+		ch.rpn = (ch.rpn & 0x7F) | (value << 7)
+	case midiRPNFineController:
+		ch := &s.channels[channel]
+		ch.rpn = (ch.rpn &^ 0x7F) | value
+	case midiDataEntryController:
+		// Only the RPN 0 (pitch bend range) is supported.
+		if ch := &s.channels[channel]; ch.rpn == 0 {
+			ch.bendRange = float64(value)
+		}
+	case midiDataEntryFineController:
+		if ch := &s.channels[channel]; ch.rpn == 0 {
+			ch.bendRange = math.Floor(ch.bendRange) + float64(value)/100
+		}
+	}
+}
+
+func (s *oscillatorSynth) PitchBend(channel, value int32) {
+	s.channels[channel].bend = float64(value-midiPitchBendCenter) / midiPitchBendCenter
+}
+
+func (s *oscillatorSynth) NoteOn(channel, key, velocity int32) {
+	ch := &s.channels[channel]
+	preset := &oscPresets[0]
+	if int(ch.patchNumber) < len(oscPresets) {
+		preset = &oscPresets[ch.patchNumber]
+	}
+
+	if len(s.voices) == oscMaxVoices {
+		// Steal the oldest voice.
+		copy(s.voices, s.voices[1:])
+		s.voices = s.voices[:len(s.voices)-1]
+	}
+
+	freq := 440 * math.Pow(2, float64(key-69)/12)
+	cutoff := math.Min(preset.cutoff*freq, 0.45*float64(s.sampleRate))
+	volume := float64(ch.volume) / 127
+	s.noiseSeed = s.noiseSeed*1664525 + 1013904223
+	s.voices = append(s.voices, &oscVoice{
+		channel:       channel,
+		key:           key,
+		preset:        preset,
+		phaseStep:     freq / float64(s.sampleRate),
+		basePhaseStep: freq / float64(s.sampleRate),
+		gain:          oscMasterVolume * (float64(velocity) / 127) * volume * volume,
+		filterCoeff:   1 - math.Exp(-2*math.Pi*cutoff/float64(s.sampleRate)),
+		noise:         s.noiseSeed | 1,
+	})
+}
+
+func (s *oscillatorSynth) NoteOff(channel, key int32) {
+	for _, v := range s.voices {
+		if v.channel == channel && v.key == key && v.stage < envelopeRelease {
+			v.releaseLevel = v.level
+			v.stage = envelopeRelease
+			v.stageTime = 0
+		}
+	}
+}
+
+func (s *oscillatorSynth) Render(left, right []float32) {
+	for i := range left {
+		left[i] = 0
+		right[i] = 0
+	}
+
+	dt := 1.0 / float64(s.sampleRate)
+	live := s.voices[:0]
+	for _, v := range s.voices {
+		// The same constant power panning law as in meltysynth.
+		ch := &s.channels[v.channel]
+		angle := (math.Pi / 2) * float64(ch.pan) / 127
+		// The bend only changes between the blocks, see noteRenderer.
+		v.phaseStep = v.basePhaseStep * ch.frequencyFactor()
+		leftGain := float32(v.gain * math.Cos(angle))
+		rightGain := float32(v.gain * math.Sin(angle))
+		for i := range left {
+			x := v.next(dt)
+			left[i] += leftGain * x
+			right[i] += rightGain * x
+		}
+		if v.stage != envelopeDone {
+			live = append(live, v)
+		}
+	}
+	s.voices = live
+}
+
+func (v *oscVoice) next(dt float64) float32 {
+	if v.stage == envelopeDone {
+		return 0
+	}
+
+	var x float64
+	switch v.preset.waveform {
+	case oscSine:
+		x = math.Sin(2 * math.Pi * v.phase)
+	case oscSaw:
+		x = 2*v.phase - 1
+	case oscSquare:
+		x = 1
+		if v.phase >= 0.5 {
+			x = -1
+		}
+	case oscNoise:
+		// xorshift32
+		v.noise ^= v.noise << 13
+		v.noise ^= v.noise >> 17
+		v.noise ^= v.noise << 5
+		x = float64(v.noise)/(1<<31) - 1
+	}
+	v.phase += v.phaseStep
+	if v.phase >= 1 {
+		v.phase -= 1
+	}
+
+	v.filterState += v.filterCoeff * (x - v.filterState)
+
+	return float32(v.filterState * v.nextLevel(dt))
+}
+
+func (v *oscVoice) nextLevel(dt float64) float64 {
+	p := v.preset
+	v.stageTime += dt
+	switch v.stage {
+	case envelopeAttack:
+		v.level = math.Min(v.stageTime/p.attack, 1)
+		if v.stageTime >= p.attack {
+			v.stage = envelopeDecay
+			v.stageTime = 0
+		}
+	case envelopeDecay:
+		v.level = 1 - (1-p.sustain)*math.Min(v.stageTime/p.decay, 1)
+		if v.stageTime >= p.decay {
+			v.stage = envelopeSustain
+			if p.sustain == 0 {
+				v.stage = envelopeDone
+			}
+		}
+	case envelopeSustain:
+		v.level = p.sustain
+	case envelopeRelease:
+		v.level = v.releaseLevel * (1 - math.Min(v.stageTime/p.release, 1))
+		if v.stageTime >= p.release {
+			v.stage = envelopeDone
+		}
+	}
+	return v.level
+}
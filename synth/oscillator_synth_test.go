@@ -0,0 +1,130 @@
+package synth
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOscillatorSynthPitch(t *testing.T) {
+	for patch := range oscPresets {
+		if oscPresets[patch].waveform == oscNoise || oscPresets[patch].sustain == 0 {
+			continue
+		}
+		s := newOscillatorSynth(44100)
+		s.ProgramChange(0, int32(patch))
+		s.NoteOn(0, 69, 100)
+		left := make([]float32, 44100)
+		right := make([]float32, 44100)
+		s.Render(left, right)
+
+		crossings := 0
+		for i := 1; i < len(left); i++ {
+			if left[i-1] < 0 && left[i] >= 0 {
+				crossings++
+			}
+		}
+		if crossings < 438 || crossings > 442 {
+			t.Errorf("patch %d: expected ~440 periods per second, got %d", patch, crossings)
+		}
+	}
+}
+
+func TestOscillatorSynthPitchBend(t *testing.T) {
+	tests := []struct {
+		bendRange int32
+		bend      int32
+		want      int
+	}{
+		{bendRange: 2, bend: midiPitchBendCenter, want: 440},
+		// The default 2 semitones range.
+		{bendRange: -1, bend: 16383, want: 494},
+		{bendRange: 12, bend: 0, want: 220},
+		{bendRange: 12, bend: midiPitchBendCenter + midiPitchBendCenter/2, want: 622},
+		{bendRange: 24, bend: 16383, want: 1760},
+	}
+
+	for _, test := range tests {
+		s := newOscillatorSynth(44100)
+		s.ProgramChange(0, 2)
+		if test.bendRange != -1 {
+			s.ControlChange(0, midiRPNCoarseController, 0)
+			s.ControlChange(0, midiRPNFineController, 0)
+			s.ControlChange(0, midiDataEntryController, test.bendRange)
+			s.ControlChange(0, midiRPNCoarseController, 127)
+			s.ControlChange(0, midiRPNFineController, 127)
+			// Ignored: no RPN is selected.
+			s.ControlChange(0, midiDataEntryController, 1)
+		}
+		s.NoteOn(0, 69, 100)
+		s.PitchBend(0, test.bend)
+		left := make([]float32, 44100)
+		right := make([]float32, 44100)
+		s.Render(left, right)
+
+		crossings := 0
+		for i := 1; i < len(left); i++ {
+			if left[i-1] < 0 && left[i] >= 0 {
+				crossings++
+			}
+		}
+		if crossings < test.want-2 || crossings > test.want+2 {
+			t.Errorf("range=%d bend=%d: expected ~%d periods per second, got %d", test.bendRange, test.bend, test.want, crossings)
+		}
+	}
+}
+
+func TestOscillatorSynthEnvelope(t *testing.T) {
+	s := newOscillatorSynth(44100)
+	s.ProgramChange(0, 2)
+	s.NoteOn(0, 60, 100)
+
+	buf := make([]float32, 4410)
+	peak := func() float64 {
+		left := buf
+		right := make([]float32, len(buf))
+		s.Render(left, right)
+		result := 0.0
+		for _, v := range left {
+			result = math.Max(result, math.Abs(float64(v)))
+		}
+		return result
+	}
+
+	if peak() == 0 {
+		t.Fatal("silent note")
+	}
+	s.NoteOff(0, 60)
+	for i := 0; i < 5; i++ {
+		peak()
+	}
+	if p := peak(); p != 0 {
+		t.Fatalf("the note is still playing after the release: %f", p)
+	}
+	if len(s.voices) != 0 {
+		t.Fatalf("%d voices are still active", len(s.voices))
+	}
+}
+
+func TestOscillatorSynthReset(t *testing.T) {
+	s := newOscillatorSynth(44100)
+	render := func() []float32 {
+		left := make([]float32, 2000)
+		right := make([]float32, 2000)
+		s.ProgramChange(3, 5)
+		s.ControlChange(3, midiPanController, 20)
+		s.NoteOn(3, 50, 90)
+		s.Render(left[:1000], right[:1000])
+		s.NoteOn(3, 62, 90)
+		s.Render(left[1000:], right[1000:])
+		return append(left, right...)
+	}
+
+	first := render()
+	s.Reset()
+	second := render()
+	for i := range first {
+		if first[i] != second[i] {
+			t.Fatalf("sample[%d] mismatch after Reset: %f vs %f", i, first[i], second[i])
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package synth
+
+import (
+	"math"
+	"sort"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+type Program struct {
+	Length      float64
+	Instruments []ProgramInstrument
+	Scale       synthdb.Scale
+	Tempo       synthdb.Tempo
+
+	// MuteZones are the plot regions where the notes are not played.
+	// The X axis is the time, the Y axis is the instrument function value.
+	MuteZones []gmath.Rect
+}
+
+// IsMuted reports whether the note played at t by the instrument is in a mute zone.
+func (prog *Program) IsMuted(inst *ProgramInstrument, t float64) bool {
+	if len(prog.MuteZones) == 0 {
+		return false
+	}
+	pos := gmath.Vec{X: t, Y: inst.Func.Run(t)}
+	for _, zone := range prog.MuteZones {
+		if zone.Contains(pos) {
+			return true
+		}
+	}
+	return false
+}
+
+type ProgramInstrument struct {
+	ID     int // The channel is identical
+	Index  int
+	Func   *exprc.FuncRunner
+	Period *exprc.FuncRunner
+	Kind   gamedata.InstrumentKind
+
+	// The optional note shaping functions, nil if unset.
+	// They don't affect the notes timing.
+	Gate  *exprc.FuncRunner
+	Pan   *exprc.FuncRunner
+	Chord *exprc.FuncRunner
+}
+
+const (
+	minPeriod = 0.1
+	maxPeriod = 2 * math.Pi
+)
+
+// PeriodAt returns the delay between the note played at t and the next one.
+func (inst *ProgramInstrument) PeriodAt(t float64) float64 {
+	return gmath.Clamp(inst.Period.Run(t), minPeriod, maxPeriod)
+}
+
+type ProgramRunner struct {
+	events []NoteActivation
+}
+
+// NoteActivation is a moment when an instrument plays a note.
+type NoteActivation struct {
+	// Index is an instrument index inside the program.
+	Index int
+
+	// ID is an instrument slot ID.
+	ID int
+
+	T      float64
+	Period float64
+}
+
+func (r *ProgramRunner) RunProgram(prog Program) []NoteActivation {
+	r.events = r.events[:0]
+
+	grid := prog.Tempo.Grid()
+	for i := range prog.Instruments {
+		inst := &prog.Instruments[i]
+		t := inst.PeriodAt(0)
+		prevOnset := -1.0
+		for t < prog.Length {
+			period := inst.PeriodAt(t)
+			onset := t
+			t += period
+			if grid != 0 {
+				// Only the onsets are quantized, the instrument keeps
+				// its own time to avoid the rounding errors accumulation.
+				// The notes snapped to the same grid step are merged.
+				onset = math.Round(onset/grid) * grid
+				if onset == prevOnset || onset >= prog.Length {
+					continue
+				}
+			}
+			prevOnset = onset
+			if prog.IsMuted(inst, onset) {
+				continue
+			}
+			r.events = append(r.events, NoteActivation{
+				Index:  i,
+				ID:     inst.ID,
+				T:      onset,
+				Period: period,
+			})
+		}
+	}
+
+	// This whole thing can be done without an extra sorting
+	// if we would construct the events slice in already sorted form.
+	// But since the number of events is usually relatively small
+	// and it's a jam game, I don't want to bother optimizing this.
+	// The current solution at least provides the precise timings
+	// using a per-instrument t step.
+	if len(prog.Instruments) > 1 {
+		sort.SliceStable(r.events, func(i, j int) bool {
+			return r.events[i].T < r.events[j].T
+		})
+	}
+
+	return r.events
+}
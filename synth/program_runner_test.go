@@ -0,0 +1,56 @@
+package synth
+
+import (
+	"math"
+	"testing"
+
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+func TestRunProgramSnapToGrid(t *testing.T) {
+	// 120 BPM 4/4: a 16th note is 0.125 seconds.
+	tempo := synthdb.ParseTempo(120, "4/4", true)
+
+	tests := []struct {
+		period string
+		want   []float64
+	}{
+		// Already on the grid.
+		{period: "beat", want: []float64{0.5, 1, 1.5}},
+		{period: "3*16th", want: []float64{0.375, 0.75, 1.125, 1.5}},
+
+		// 0.3, 0.6, 0.9, 1.2, 1.5 are snapped to the nearest 16th.
+		{period: "0.3", want: []float64{0.25, 0.625, 0.875, 1.25, 1.5}},
+
+		// Several notes within one grid step are merged.
+		{period: "0.1", want: []float64{0.125, 0.25, 0.375, 0.5, 0.625, 0.75, 0.875, 1, 1.125, 1.25, 1.375, 1.5}},
+	}
+
+	for _, test := range tests {
+		period, err := exprc.CompileWithConsts(test.period, tempo.Units())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fx, _ := exprc.Compile("1")
+		prog := Program{
+			Length:      1.6,
+			Tempo:       tempo,
+			Instruments: []ProgramInstrument{{Func: fx, Period: period}},
+		}
+		var runner ProgramRunner
+		events := runner.RunProgram(prog)
+		have := make([]float64, len(events))
+		for i, e := range events {
+			have[i] = e.T
+		}
+		if len(have) != len(test.want) {
+			t.Fatalf("%s:\nhave: %v\nwant: %v", test.period, have, test.want)
+		}
+		for i := range have {
+			if math.Abs(have[i]-test.want[i]) > 1e-9 {
+				t.Fatalf("%s:\nhave: %v\nwant: %v", test.period, have, test.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package synth
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quasilyte/gmath"
+)
+
+// SampleStream is a 16-bit stereo PCM source that renders
+// the program samples on demand.
+//
+// It implements io.ReadSeeker, so it can be used as an audio player source.
+// Only the samples that are about to be played are rendered,
+// the playback can start without a full track pre-render.
+type SampleStream struct {
+	mixer *stemMixer
+
+	samples *SampleSet
+
+	// rendered is a mixer position that is safe to read
+	// from the goroutines other than the audio player one.
+	rendered atomic.Int64
+
+	// limiterStats is a copy of the mixer limiter stats
+	// that is safe to read from the other goroutines.
+	limiterStatsMu sync.Mutex
+	limiterStats   LimiterStats
+}
+
+const bytesPerSample = 4 // 2 channels, 16 bits per channel
+
+func newSampleStream(mixer *stemMixer) *SampleStream {
+	return &SampleStream{
+		mixer: mixer,
+		samples: &SampleSet{
+			PerSecond: int(mixer.sampleRate),
+			Left:      make([]float32, mixer.length),
+			Right:     make([]float32, mixer.length),
+		},
+	}
+}
+
+// Samples returns the float samples rendered by this stream.
+// Only the first Pos() samples are valid.
+func (s *SampleStream) Samples() *SampleSet {
+	return s.samples
+}
+
+func (s *SampleStream) SampleRate() int {
+	return int(s.mixer.sampleRate)
+}
+
+// Pos returns the number of samples rendered so far.
+// This is the stream sample clock.
+//
+// It's safe to call Pos concurrently with Read.
+func (s *SampleStream) Pos() int {
+	return int(s.rendered.Load())
+}
+
+// LimiterStats returns the mix limiter activity stats
+// for the samples rendered so far.
+// The stage can use it to show a clipping indicator.
+//
+// It's safe to call LimiterStats concurrently with Read.
+func (s *SampleStream) LimiterStats() LimiterStats {
+	s.limiterStatsMu.Lock()
+	defer s.limiterStatsMu.Unlock()
+	return s.limiterStats
+}
+
+// InstrumentSamples appends the mono instrument samples
+// in [from, to) range to dst, they are scaled by the instrument volume.
+// The result is nil if the instrument is not a part of the mix.
+//
+// Unlike Samples, it can be used to analyze the individual
+// instruments contribution to the mix.
+// Only the samples before Pos() are guaranteed to be available.
+//
+// It's safe to call InstrumentSamples concurrently with Read.
+func (s *SampleStream) InstrumentSamples(dst []float64, id, from, to int) []float64 {
+	m := s.mixer
+	for i, stemID := range m.ids {
+		if stemID == id {
+			return m.stems[i].readMono(dst, from, to, m.gain*m.gains[i])
+		}
+	}
+	return nil
+}
+
+// Prerender synthesizes the instrument samples up to the pos sample,
+// so the following Seek to pos only has to mix them.
+//
+// The synthesis of a long track part can take a while;
+// Prerender is meant to be called from a background goroutine
+// and it stops with an error when ctx is cancelled.
+//
+// It's safe to call Prerender concurrently with Read.
+func (s *SampleStream) Prerender(ctx context.Context, pos int) error {
+	pos = gmath.Clamp(pos, 0, s.mixer.length)
+	// The stems are rendered in chunks, so the audio player
+	// doesn't wait for the stem lock for too long.
+	chunkSize := int(s.mixer.sampleRate) / 10
+	for _, st := range s.mixer.stems {
+		for !st.renderChunk(chunkSize, pos) {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsPrerendered reports whether the instrument samples
+// up to the pos sample are already synthesized.
+// If it returns false, a Seek to pos can be slow, see Prerender.
+//
+// It's safe to call IsPrerendered concurrently with Read.
+func (s *SampleStream) IsPrerendered(pos int) bool {
+	pos = gmath.Clamp(pos, 0, s.mixer.length)
+	for _, st := range s.mixer.stems {
+		if !st.renderChunk(0, pos) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *SampleStream) render(left, right []float32) int {
+	n := s.mixer.Render(left, right)
+	s.rendered.Store(int64(s.mixer.pos))
+	if s.mixer.limiter != nil {
+		s.limiterStatsMu.Lock()
+		s.limiterStats = s.mixer.limiter.stats
+		s.limiterStatsMu.Unlock()
+	}
+	return n
+}
+
+func (s *SampleStream) Read(b []byte) (int, error) {
+	if s.mixer.IsDone() {
+		return 0, io.EOF
+	}
+
+	numSamples := len(b) / bytesPerSample
+	if numSamples == 0 {
+		return 0, nil
+	}
+	left, right := s.nextSamples(numSamples)
+	n := s.render(left, right)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint16(b[i*bytesPerSample:], uint16(pcmSample(left[i])))
+		binary.LittleEndian.PutUint16(b[i*bytesPerSample+2:], uint16(pcmSample(right[i])))
+	}
+
+	return n * bytesPerSample, nil
+}
+
+// Seek implements io.Seeker.
+//
+// A forward seek mixes the skipped samples, it's only fast
+// if the instrument samples are prerendered, see Prerender.
+func (s *SampleStream) Seek(offset int64, whence int) (int64, error) {
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = int64(s.mixer.pos*bytesPerSample) + offset
+	case io.SeekEnd:
+		pos = int64(s.mixer.length*bytesPerSample) + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if pos < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	samplePos := int(pos / bytesPerSample)
+	if samplePos > s.mixer.length {
+		samplePos = s.mixer.length
+	}
+	if samplePos < s.mixer.pos {
+		s.mixer.Reset()
+		s.rendered.Store(0)
+		s.limiterStatsMu.Lock()
+		s.limiterStats = LimiterStats{}
+		s.limiterStatsMu.Unlock()
+	}
+	// The skipped samples are mixed too, so Samples() stay
+	// valid up to Pos() and the stems are rendered in order.
+	if err := s.skip(samplePos - s.mixer.pos); err != nil {
+		return 0, err
+	}
+
+	return int64(samplePos * bytesPerSample), nil
+}
+
+func (s *SampleStream) nextSamples(numSamples int) ([]float32, []float32) {
+	from := s.mixer.pos
+	to := from + numSamples
+	if to > s.mixer.length {
+		to = s.mixer.length
+	}
+	return s.samples.Left[from:to], s.samples.Right[from:to]
+}
+
+func (s *SampleStream) skip(numSamples int) error {
+	left, right := s.nextSamples(numSamples)
+	n := s.render(left, right)
+	if n != numSamples {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+func pcmSample(v float32) int16 {
+	const a = 32768.0
+	x := math.Round(float64(v) * a)
+	switch {
+	case x > math.MaxInt16:
+		return math.MaxInt16
+	case x < math.MinInt16:
+		return math.MinInt16
+	default:
+		return int16(x)
+	}
+}
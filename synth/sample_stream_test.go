@@ -0,0 +1,253 @@
+package synth
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+func readStream(t *testing.T, s *SampleStream, chunkSizes []int) []byte {
+	t.Helper()
+
+	var result []byte
+	for i := 0; ; i++ {
+		buf := make([]byte, chunkSizes[i%len(chunkSizes)])
+		n, err := s.Read(buf)
+		result = append(result, buf[:n]...)
+		if err == io.EOF {
+			return result
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestStreamMatchesPCM(t *testing.T) {
+	fonts := []*synthdb.SoundFont{
+		loadTestSoundFont(t),
+		synthdb.Chiptune,
+	}
+	for _, sf := range fonts {
+		sf := sf
+		t.Run(sf.Name, func(t *testing.T) {
+			testStreamMatchesPCM(t, sf)
+		})
+	}
+}
+
+func testStreamMatchesPCM(t *testing.T, sf *synthdb.SoundFont) {
+	instruments := []testInstrument{
+		{fx: "sin(x)+1", gate: "0.5", period: "0.3"},
+		{fx: "x/2", pan: "sin(x)", period: "0.7"},
+	}
+
+	p, prog := newTestMusicPlayer(t, sf, instruments)
+	for _, inst := range p.instruments {
+		inst.mappedVolume = 100
+	}
+	offline := renderTestPCM(t, p, prog)
+
+	p, prog = newTestMusicPlayer(t, sf, instruments)
+	for _, inst := range p.instruments {
+		inst.mappedVolume = 100
+	}
+	stream := p.createStream(prog, 1)
+
+	// Odd chunk sizes make the chunk boundaries fall
+	// between the note events and in the middle of the samples.
+	chunkSizes := []int{4 * 333, 4 * 4096, 4*17 + 2, 4 * 1000}
+
+	check := func(data []byte) {
+		t.Helper()
+		if len(data) != len(offline.Left)*bytesPerSample {
+			t.Fatalf("stream length mismatch: have %d bytes, want %d", len(data), len(offline.Left)*bytesPerSample)
+		}
+		for i := range offline.Left {
+			left := int16(binary.LittleEndian.Uint16(data[i*bytesPerSample:]))
+			right := int16(binary.LittleEndian.Uint16(data[i*bytesPerSample+2:]))
+			if left != pcmSample(offline.Left[i]) || right != pcmSample(offline.Right[i]) {
+				t.Fatalf("sample[%d] mismatch: have (%d, %d), want (%d, %d)",
+					i, left, right, pcmSample(offline.Left[i]), pcmSample(offline.Right[i]))
+			}
+		}
+	}
+
+	data := readStream(t, stream, chunkSizes)
+	check(data)
+	if stream.Pos() != len(offline.Left) {
+		t.Fatalf("stream pos is %d, want %d", stream.Pos(), len(offline.Left))
+	}
+
+	if _, err := stream.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	check(readStream(t, stream, chunkSizes[1:]))
+
+	// Seeking forward renders the skipped part, so the tail is the same.
+	offset := int64(len(data) / 2 / bytesPerSample * bytesPerSample)
+	if _, err := stream.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	tail := readStream(t, stream, chunkSizes)
+	if string(tail) != string(data[offset:]) {
+		t.Fatal("the stream tail after the seek doesn't match")
+	}
+}
+
+func TestStreamPrerender(t *testing.T) {
+	instruments := []testInstrument{
+		{fx: "sin(x)+1", gate: "0.5", period: "0.3"},
+		{fx: "x/2", pan: "sin(x)", period: "0.7"},
+	}
+	newStream := func() *SampleStream {
+		p, prog := newTestMusicPlayer(t, synthdb.Chiptune, instruments)
+		return p.createStream(prog, 1)
+	}
+
+	want := readStream(t, newStream(), []int{4 * 1000})
+	offset := len(want) / 2 / bytesPerSample
+
+	stream := newStream()
+	if stream.IsPrerendered(offset) {
+		t.Fatal("a new stream is prerendered")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := stream.Prerender(ctx, offset); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled prerender: have %v error", err)
+	}
+	if err := stream.Prerender(context.Background(), offset); err != nil {
+		t.Fatal(err)
+	}
+	if !stream.IsPrerendered(offset) || stream.IsPrerendered(offset+1) {
+		t.Fatalf("expected the stream to be prerendered up to %d", offset)
+	}
+	if stream.Pos() != 0 {
+		t.Fatalf("prerender moved the stream to %d", stream.Pos())
+	}
+
+	// The prerendered samples are the same as the ones rendered on demand.
+	if _, err := stream.Seek(int64(offset*bytesPerSample), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	tail := readStream(t, stream, []int{4 * 333})
+	if string(tail) != string(want[offset*bytesPerSample:]) {
+		t.Fatal("the stream tail after the prerendered seek doesn't match")
+	}
+}
+
+func TestStreamInstrumentSamples(t *testing.T) {
+	p, prog := newTestMusicPlayer(t, synthdb.Chiptune, []testInstrument{
+		{fx: "sin(x)+1", period: "0.3"},
+		{fx: "x/2", period: "0.7"},
+	})
+	for _, inst := range p.instruments {
+		inst.mappedVolume = 60
+	}
+	stream := p.createStream(prog, 1)
+	readStream(t, stream, []int{4 * 1000})
+	if stats := stream.LimiterStats(); stats.IsClipping() {
+		t.Fatalf("the test mix is clipping: %+v", stats)
+	}
+
+	// Without the limiting, the instruments sum up to the mix.
+	samples := stream.Samples()
+	from, to := 1000, stream.Pos()
+	first := stream.InstrumentSamples(nil, 0, from, to)
+	second := stream.InstrumentSamples(nil, 1, from, to)
+	if len(first) != to-from || len(second) != to-from {
+		t.Fatalf("unexpected samples count: %d and %d", len(first), len(second))
+	}
+	for i := from; i < to; i++ {
+		mono := float64(samples.Left[i] + samples.Right[i])
+		if sum := first[i-from] + second[i-from]; math.Abs(sum-mono) > 1e-5 {
+			t.Fatalf("sample[%d]: the instruments sum is %f, the mix is %f", i, sum, mono)
+		}
+	}
+
+	if stream.InstrumentSamples(nil, 2, from, to) != nil {
+		t.Fatal("unexpected samples of the missing instrument")
+	}
+}
+
+func TestStreamSpeed(t *testing.T) {
+	instruments := []testInstrument{
+		{fx: "1", period: "0.5"},
+	}
+	render := func(speed float64) *SampleSet {
+		p, prog := newTestMusicPlayer(t, synthdb.Chiptune, instruments)
+		p.instruments[0].mappedVolume = 100
+		stream := p.createStream(prog, speed)
+		readStream(t, stream, []int{4 * 1024})
+		return stream.Samples()
+	}
+	firstSound := func(samples *SampleSet) int {
+		for i, v := range samples.Left {
+			if v != 0 {
+				return i
+			}
+		}
+		return -1
+	}
+	zeroCrossings := func(samples []float32) int {
+		n := 0
+		for i := 1; i < len(samples); i++ {
+			if (samples[i-1] < 0) != (samples[i] < 0) {
+				n++
+			}
+		}
+		return n
+	}
+
+	normal := render(1)
+	slow := render(0.25)
+	if len(slow.Left) != 4*len(normal.Left) {
+		t.Fatalf("slow stream length: have %d, want %d", len(slow.Left), 4*len(normal.Left))
+	}
+
+	normalOnset := firstSound(normal)
+	slowOnset := firstSound(slow)
+	if normalOnset == -1 || slowOnset == -1 {
+		t.Fatal("silent stream")
+	}
+	if diff := slowOnset - 4*normalOnset; diff < -4 || diff > 4 {
+		t.Fatalf("slow stream onset: have %d, want %d", slowOnset, 4*normalOnset)
+	}
+
+	// The pitch is the same.
+	window := normal.PerSecond / 10
+	normalCrossings := zeroCrossings(normal.Left[normalOnset : normalOnset+window])
+	slowCrossings := zeroCrossings(slow.Left[slowOnset : slowOnset+window])
+	if diff := normalCrossings - slowCrossings; diff < -1 || diff > 1 {
+		t.Fatalf("the pitch is changed: %d vs %d zero crossings", normalCrossings, slowCrossings)
+	}
+}
+
+func TestSetPlaybackSpeed(t *testing.T) {
+	s := NewSynthesizer(Config{MaxInstruments: 1}, synthdb.Chiptune)
+	tests := []struct {
+		speed float64
+		want  float64
+	}{
+		{0.5, 0.5},
+		{1, 1},
+		{0, MinPlaybackSpeed},
+		{-2, MinPlaybackSpeed},
+		{0.01, MinPlaybackSpeed},
+		{4, 1},
+		{math.Inf(1), 1},
+		{math.NaN(), 1},
+	}
+	for _, test := range tests {
+		s.SetPlaybackSpeed(test.speed)
+		if have := s.GetPlaybackSpeed(); have != test.want {
+			t.Fatalf("SetPlaybackSpeed(%v): have %v, want %v", test.speed, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package synth
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+// stemKey describes everything that affects the stem synthesis.
+// The instrument volume is not a part of it: it's applied during the mixing.
+//
+// The compiled functions are compared by identity:
+// every (re)compilation produces a new function object.
+type stemKey struct {
+	fx     *exprc.FuncRunner
+	period *exprc.FuncRunner
+	gate   *exprc.FuncRunner
+	pan    *exprc.FuncRunner
+	chord  *exprc.FuncRunner
+
+	// chordFunc identifies the chord shape.
+	chordFunc string
+
+	patchNumber int32
+	bank        int32
+	percussion  bool
+	reverbSend  float64
+	chorusSend  float64
+	glideRange  int32
+
+	scale  synthdb.Scale
+	grid   float64
+	length int
+
+	// muteZones is a printed form of the program mute zones,
+	// the slices can't be compared directly.
+	muteZones string
+}
+
+func newStemKey(inst *instrument, prog Program, length int) stemKey {
+	return stemKey{
+		fx:          inst.compiledFx,
+		period:      inst.compiledPeriod,
+		gate:        inst.compiledGate,
+		pan:         inst.compiledPan,
+		chord:       inst.compiledChord,
+		chordFunc:   inst.chordFunc,
+		patchNumber: inst.patchNumber,
+		bank:        inst.bank,
+		percussion:  inst.percussion,
+		reverbSend:  inst.reverbSend,
+		chorusSend:  inst.chorusSend,
+		glideRange:  inst.glideRange,
+		scale:       prog.Scale,
+		grid:        prog.Tempo.Grid(),
+		length:      length,
+		muteZones:   fmt.Sprint(prog.MuteZones),
+	}
+}
+
+// stem is a single instrument track rendered at the full volume.
+//
+// The samples are rendered lazily, only up to the position that was requested.
+// Once rendered, they can be re-mixed with any volume without the re-synthesis.
+//
+// A stem can be shared between several sample streams,
+// so all accesses are synchronized.
+type stem struct {
+	key stemKey
+
+	mu       sync.Mutex
+	renderer *noteRenderer
+	left     []float32
+	right    []float32
+}
+
+func newStem(key stemKey, renderer *noteRenderer) *stem {
+	return &stem{
+		key:      key,
+		renderer: renderer,
+		left:     make([]float32, renderer.length),
+		right:    make([]float32, renderer.length),
+	}
+}
+
+// mixInto adds the stem samples in [from, from+len(left)) range
+// multiplied by gain to the left and right buffers.
+func (s *stem) mixInto(left, right []float32, from int, gain float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	to := from + len(left)
+	s.renderTo(to)
+	stemLeft := s.left[from:to]
+	stemRight := s.right[from:to]
+	for i := range left {
+		left[i] += gain * stemLeft[i]
+		right[i] += gain * stemRight[i]
+	}
+}
+
+// renderChunk renders up to n more samples, but not past the to position.
+// It reports whether the stem is rendered up to to.
+func (s *stem) renderChunk(n, to int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.renderTo(gmath.ClampMax(s.renderer.pos+n, to))
+	return s.renderer.pos >= to
+}
+
+// renderTo renders the samples up to the given position.
+// The caller should hold the mutex.
+func (s *stem) renderTo(to int) {
+	if pos := s.renderer.pos; pos < to {
+		s.renderer.Render(s.left[pos:to], s.right[pos:to])
+	}
+}
+
+// readMono appends the mono (left+right) stem samples
+// in [from, to) range multiplied by gain to dst.
+// The samples that are not rendered yet are skipped.
+func (s *stem) readMono(dst []float64, from, to int, gain float32) []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if to > s.renderer.pos {
+		to = s.renderer.pos
+	}
+	for i := from; i < to; i++ {
+		dst = append(dst, float64(gain*(s.left[i]+s.right[i])))
+	}
+	return dst
+}
+
+// stemMixer combines the stems into a single track.
+type stemMixer struct {
+	stems []*stem
+	ids   []int
+	gains []float32
+
+	// gain is applied to the entire mix.
+	gain float32
+
+	// limiter is an optional mix peak limiter.
+	limiter *limiter
+
+	// scratch buffers hold the mixed samples with a limiter look-ahead.
+	scratchLeft  []float32
+	scratchRight []float32
+
+	sampleRate float64
+
+	// length is a total number of samples to be mixed.
+	length int
+
+	// pos is a number of samples mixed so far.
+	pos int
+}
+
+func (m *stemMixer) Reset() {
+	m.pos = 0
+	if m.limiter != nil {
+		m.limiter.Reset()
+	}
+}
+
+func (m *stemMixer) IsDone() bool {
+	return m.pos >= m.length
+}
+
+// Render fills the left and right buffers with the next mixed samples.
+// It returns the number of samples rendered,
+// it's less than len(left) only when the end is reached.
+func (m *stemMixer) Render(left, right []float32) int {
+	n := len(left)
+	if remaining := m.length - m.pos; n > remaining {
+		n = remaining
+	}
+
+	if m.limiter == nil {
+		m.mix(left[:n], right[:n], m.pos)
+		m.pos += n
+		return n
+	}
+
+	// The limiter needs to see the samples ahead.
+	total := n + gmath.ClampMax(m.limiter.lookahead, m.length-m.pos-n)
+	if cap(m.scratchLeft) < total {
+		m.scratchLeft = make([]float32, total)
+		m.scratchRight = make([]float32, total)
+	}
+	scratchLeft := m.scratchLeft[:total]
+	scratchRight := m.scratchRight[:total]
+	m.mix(scratchLeft, scratchRight, m.pos)
+	m.limiter.Process(scratchLeft, scratchRight, n)
+	copy(left, scratchLeft[:n])
+	copy(right, scratchRight[:n])
+	m.pos += n
+	return n
+}
+
+func (m *stemMixer) mix(left, right []float32, from int) {
+	for i := range left {
+		left[i] = 0
+		right[i] = 0
+	}
+	for i, s := range m.stems {
+		s.mixInto(left, right, from, m.gain*m.gains[i])
+	}
+}
+
+// stemGain converts the MIDI channel volume into a linear stem gain.
+// The stems are rendered with the max channel volume;
+// the synthesizer squares the channel volume, so the gain is squared too.
+func stemGain(mappedVolume int32) float32 {
+	v := float32(mappedVolume) / 127
+	return v * v
+}
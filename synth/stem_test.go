@@ -0,0 +1,63 @@
+package synth
+
+import (
+	"math"
+	"testing"
+
+	"github.com/quasilyte/sinecord/exprc"
+)
+
+func TestStemCache(t *testing.T) {
+	sf := loadTestSoundFont(t)
+
+	p, prog := newTestMusicPlayer(t, sf, []testInstrument{
+		{fx: "sin(x)+1", period: "0.5"},
+		{fx: "x/2", period: "0.7"},
+	})
+	for _, inst := range p.instruments {
+		inst.mappedVolume = 127
+	}
+	full := renderTestPCM(t, p, prog)
+	stems := append([]*stem(nil), p.stems...)
+
+	// The volume change should only re-mix the cached stems.
+	p.instruments[1].mappedVolume = 64
+	mixed := renderTestPCM(t, p, prog)
+	for i, s := range p.stems {
+		if s != stems[i] {
+			t.Fatalf("stem[%d] was re-rendered after the volume change", i)
+		}
+	}
+
+	p.instruments[0].mappedVolume = 0
+	onlySecond := renderTestPCM(t, p, prog)
+	p.instruments[1].mappedVolume = 0
+	p.instruments[0].mappedVolume = 127
+	onlyFirst := renderTestPCM(t, p, prog)
+
+	gain := stemGain(64)
+	for i := range full.Left {
+		want := onlyFirst.Left[i] + gain*(full.Left[i]-onlyFirst.Left[i])
+		if math.Abs(float64(mixed.Left[i]-want)) > 1e-5 {
+			t.Fatalf("sample[%d]: have %f, want %f", i, mixed.Left[i], want)
+		}
+		if math.Abs(float64(full.Left[i]-onlyFirst.Left[i]-onlySecond.Left[i]/gain)) > 1e-5 {
+			t.Fatalf("sample[%d]: the mix is not a sum of the stems", i)
+		}
+	}
+
+	// A new compiled function invalidates only its own stem.
+	fx, err := exprc.Compile("x/3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.instruments[1].compiledFx = fx
+	prog.Instruments[1].Func = fx
+	renderTestPCM(t, p, prog)
+	if p.stems[0] != stems[0] {
+		t.Fatal("unchanged stem was re-rendered")
+	}
+	if p.stems[1] == stems[1] {
+		t.Fatal("changed stem was not re-rendered")
+	}
+}
@@ -0,0 +1,75 @@
+package synth
+
+import (
+	"github.com/sinshu/go-meltysynth/meltysynth"
+)
+
+// SynthBackend is a MIDI-like sound generator used to render the notes.
+//
+// The channels, keys and controller values follow the MIDI conventions.
+// A backend is expected to support at least the volume and pan controllers;
+// it's free to ignore the other ones.
+type SynthBackend interface {
+	SampleRate() int
+
+	// Reset returns the backend to its initial state.
+	// The rendering after Reset should be identical to the first one.
+	Reset()
+
+	ProgramChange(channel, patchNumber int32)
+	ControlChange(channel, controller, value int32)
+
+	NoteOn(channel, key, velocity int32)
+	NoteOff(channel, key int32)
+
+	// PitchBend bends all channel notes.
+	// The value is in [0, 16383] range, 8192 is no bend.
+	// The bend range is set by the RPN 0 controllers.
+	PitchBend(channel, value int32)
+
+	// Render fills the next len(left) samples block.
+	Render(left, right []float32)
+}
+
+type meltysynthBackend struct {
+	synth *meltysynth.Synthesizer
+}
+
+func newMeltysynthBackend(sf *meltysynth.SoundFont, settings *meltysynth.SynthesizerSettings) *meltysynthBackend {
+	synth, err := meltysynth.NewSynthesizer(sf, settings)
+	if err != nil {
+		panic(err)
+	}
+	// The stems are rendered at the full scale;
+	// the mix level is controlled by the mixer.
+	synth.MasterVolume = 1
+	return &meltysynthBackend{synth: synth}
+}
+
+func (b *meltysynthBackend) SampleRate() int { return int(b.synth.SampleRate) }
+
+func (b *meltysynthBackend) Reset() { b.synth.Reset() }
+
+func (b *meltysynthBackend) ProgramChange(channel, patchNumber int32) {
+	b.synth.ProcessMidiMessage(channel, 0xC0, patchNumber, 0)
+}
+
+func (b *meltysynthBackend) ControlChange(channel, controller, value int32) {
+	b.synth.ProcessMidiMessage(channel, 0xB0, controller, value)
+}
+
+func (b *meltysynthBackend) NoteOn(channel, key, velocity int32) {
+	b.synth.NoteOn(channel, key, velocity)
+}
+
+func (b *meltysynthBackend) NoteOff(channel, key int32) {
+	b.synth.NoteOff(channel, key)
+}
+
+func (b *meltysynthBackend) PitchBend(channel, value int32) {
+	b.synth.ProcessMidiMessage(channel, 0xE0, value&0x7F, value>>7)
+}
+
+func (b *meltysynthBackend) Render(left, right []float32) {
+	b.synth.Render(left, right)
+}
@@ -0,0 +1,502 @@
+package synth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/quasilyte/gmath"
+	"github.com/quasilyte/gsignal"
+	"github.com/quasilyte/sinecord/exprc"
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+type Config struct {
+	MaxInstruments int
+
+	// Rand is used to jitter the formula recompilation checks.
+	// If nil, the checks are done with a fixed interval.
+	Rand *gmath.Rand
+}
+
+// Synthesizer turns the instrument formulas into music.
+//
+// It doesn't depend on the game graphics or the audio device,
+// so it can be used in the headless tools as well.
+// The game should call Update every frame to recompile the changed formulas.
+type Synthesizer struct {
+	config Config
+
+	runner ProgramRunner
+
+	changed bool
+
+	sf *synthdb.SoundFont
+
+	player *musicPlayer
+
+	recompileDelay float64
+
+	instruments []*instrument
+
+	scale synthdb.Scale
+
+	tempo synthdb.Tempo
+
+	// speed is a playback speed multiplier of the streams.
+	speed float64
+
+	muteZones []gmath.Rect
+
+	EventRedrawPlotRequest gsignal.Event[int]
+}
+
+func NewSynthesizer(config Config, sf *synthdb.SoundFont) *Synthesizer {
+	instruments := make([]*instrument, config.MaxInstruments)
+	for i := range instruments {
+		instruments[i] = newInstrument()
+	}
+	return &Synthesizer{
+		config:      config,
+		changed:     true,
+		sf:          sf,
+		instruments: instruments,
+		player:      newMusicPlayer(sf, instruments),
+		speed:       1,
+	}
+}
+
+func (s *Synthesizer) ForceReload() {
+	for i := range s.instruments {
+		s.reloadInstrument(i)
+	}
+}
+
+func (s *Synthesizer) reloadInstrument(i int) {
+	inst := s.instruments[i]
+	if inst.fx == "" {
+		inst.compiledFx = nil
+		s.EventRedrawPlotRequest.Emit(i)
+		return
+	}
+	fn, err := exprc.Compile(inst.fx)
+	if err != nil {
+		fmt.Printf("exprc: %v\n", err)
+		return
+	}
+	s.changed = true
+	inst.compiledFx = fn
+	s.EventRedrawPlotRequest.Emit(i)
+}
+
+func (s *Synthesizer) Update(delta float64) {
+	s.recompileDelay = gmath.ClampMin(s.recompileDelay-delta, 0)
+	if s.recompileDelay == 0 {
+		s.recompileDelay = 0.2
+		if s.config.Rand != nil {
+			s.recompileDelay = s.config.Rand.FloatRange(0.15, 0.3)
+		}
+		if i := s.needsPlotRedraw(); i != -1 {
+			s.reloadInstrument(i)
+		}
+	}
+}
+
+func (s *Synthesizer) HasChanges() bool {
+	return s.changed
+}
+
+func (s *Synthesizer) ExportTrack() gamedata.Track {
+	var t gamedata.Track
+	if s.sf != synthdb.TimGM6mb {
+		t.SoundFont = s.sf.Name
+	}
+	if s.scale.Mode != synthdb.ChromaticScale {
+		t.ScaleRoot = s.scale.RootName()
+		t.ScaleMode = s.scale.Mode.String()
+	}
+	if s.tempo != (synthdb.Tempo{}) && s.tempo != synthdb.DefaultTempo {
+		t.BPM = s.tempo.BPM
+		t.TimeSignature = s.tempo.Signature()
+		t.SnapToGrid = s.tempo.SnapToGrid
+	}
+	for _, inst := range s.instruments {
+		t.Instruments = append(t.Instruments, gamedata.InstrumentSettings{
+			Function:       inst.fx,
+			PeriodFunction: inst.periodFunc,
+			GateFunction:   inst.gateFunc,
+			PanFunction:    inst.panFunc,
+			Chord:          inst.chordFunc,
+			Glide:          int(inst.glideRange),
+			Volume:         inst.volume,
+			ReverbSend:     inst.reverbSend,
+			ChorusSend:     inst.chorusSend,
+			InstrumentName: s.sf.Instruments[inst.instrumentIndex].Name,
+			Enabled:        inst.enabled,
+		})
+	}
+	return t
+}
+
+// CreatePCM renders the whole track.
+// The progress function is called with [0, 1] values; it can be nil.
+// The rendering is aborted with the context error if ctx is cancelled.
+func (s *Synthesizer) CreatePCM(ctx context.Context, progress func(float64)) (*SampleSet, Program, error) {
+	if !s.changed {
+		return nil, Program{}, nil
+	}
+	prog := s.CreateProgram(-1)
+	samples, err := s.player.createPCM(ctx, prog, progress)
+	if err != nil {
+		return nil, Program{}, err
+	}
+	s.changed = false
+	return samples, prog, nil
+}
+
+// CreateStream is like CreatePCM, but the samples are rendered on demand.
+// The returned stream can be used as an audio player source.
+//
+// The stream is rendered with the playback speed, see SetPlaybackSpeed.
+func (s *Synthesizer) CreateStream() (*SampleStream, Program) {
+	if !s.changed {
+		return nil, Program{}
+	}
+	s.changed = false
+	prog := s.CreateProgram(-1)
+	return s.player.createStream(prog, s.speed), prog
+}
+
+// CreateExport captures the current track state for the multi-stem export.
+// Only the enabled instruments are exported.
+func (s *Synthesizer) CreateExport() *TrackExport {
+	prog := s.CreateProgram(-1)
+	e := s.player.createExport(prog)
+	for _, progInst := range prog.Instruments {
+		inst := s.instruments[progInst.ID]
+		name := s.sf.Instruments[inst.instrumentIndex].Name
+		e.Manifest.Stems = append(e.Manifest.Stems, ExportStem{
+			File:           stemFileName(progInst.ID+1, name),
+			Slot:           progInst.ID + 1,
+			InstrumentName: name,
+			PatchNumber:    int(inst.patchNumber),
+			Function:       inst.fx,
+			PeriodFunction: inst.periodFunc,
+			GateFunction:   inst.gateFunc,
+			PanFunction:    inst.panFunc,
+			Chord:          inst.chordFunc,
+			Glide:          int(inst.glideRange),
+			Volume:         inst.volume,
+		})
+	}
+	return e
+}
+
+// CreateNotes returns the notes played by the enabled instruments.
+func (s *Synthesizer) CreateNotes() []Note {
+	return s.player.createNotes(s.CreateProgram(-1))
+}
+
+// WriteMIDI encodes the enabled instruments as a Standard MIDI File.
+// Every instrument uses its own channel, except for the drum kits
+// that share the percussion channel.
+func (s *Synthesizer) WriteMIDI(w io.Writer) error {
+	prog := s.CreateProgram(-1)
+	return writeMIDI(w, s.player.createSequence(prog), prog.Length, prog.Tempo)
+}
+
+func (s *Synthesizer) CreateProgram(instrumentSelector int) Program {
+	numInstruments := s.config.MaxInstruments
+	if instrumentSelector != -1 {
+		numInstruments = 1
+	}
+	prog := Program{
+		Length:      20,
+		Instruments: make([]ProgramInstrument, 0, numInstruments),
+		Scale:       s.scale,
+		Tempo:       s.tempo,
+		MuteZones:   s.muteZones,
+	}
+
+	for id, inst := range s.instruments {
+		var selected bool
+		if instrumentSelector != -1 {
+			selected = id == instrumentSelector
+		} else {
+			selected = inst.enabled && inst.compiledFx != nil
+		}
+		if !selected || inst.compiledPeriod == nil {
+			continue
+		}
+		index := len(prog.Instruments)
+		prog.Instruments = append(prog.Instruments, ProgramInstrument{
+			ID:     id,
+			Index:  index,
+			Func:   inst.compiledFx,
+			Period: inst.compiledPeriod,
+			Kind:   inst.kind,
+			Gate:   inst.compiledGate,
+			Pan:    inst.compiledPan,
+			Chord:  inst.compiledChord,
+		})
+	}
+
+	return prog
+}
+
+func (s *Synthesizer) SetScale(scale synthdb.Scale) {
+	s.changed = true
+	s.scale = scale
+}
+
+func (s *Synthesizer) GetScale() synthdb.Scale {
+	return s.scale
+}
+
+// SetTempo changes the track musical grid.
+// The period functions are recompiled, since the beat units depend on the tempo.
+//
+// If a period can't be compiled, its instrument is not played
+// and the first of such errors is returned.
+func (s *Synthesizer) SetTempo(tempo synthdb.Tempo) error {
+	s.changed = true
+	s.tempo = tempo
+	var firstErr error
+	for i, inst := range s.instruments {
+		if inst.compiledPeriod == nil {
+			continue
+		}
+		compiled, err := s.compilePeriod(inst.periodFunc)
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("instrument %d: period: %w", i+1, err)
+		}
+		inst.compiledPeriod = compiled
+		s.EventRedrawPlotRequest.Emit(i)
+	}
+	return firstErr
+}
+
+func (s *Synthesizer) GetTempo() synthdb.Tempo {
+	return s.tempo
+}
+
+// MinPlaybackSpeed is the slowest practice playback speed.
+const MinPlaybackSpeed = 0.1
+
+// SetPlaybackSpeed changes the speed of the streams created after this call.
+// The speed is a [MinPlaybackSpeed, 1] multiplier, it's used for the practice playback.
+// The out of range values are clamped, NaN means the normal speed.
+//
+// The pitch is preserved: the notes are played for longer, but
+// the samples are rendered at the normal rate.
+// The program time runs speed times slower than the stream time.
+func (s *Synthesizer) SetPlaybackSpeed(speed float64) {
+	if math.IsNaN(speed) {
+		speed = 1
+	}
+	speed = gmath.Clamp(speed, MinPlaybackSpeed, 1)
+	if s.speed == speed {
+		return
+	}
+	s.speed = speed
+	s.changed = true
+}
+
+func (s *Synthesizer) GetPlaybackSpeed() float64 {
+	return s.speed
+}
+
+// SetMuteZones sets the plot regions where the notes are not played.
+// See Program.MuteZones.
+func (s *Synthesizer) SetMuteZones(zones []gmath.Rect) {
+	s.changed = true
+	s.muteZones = zones
+}
+
+func (s *Synthesizer) SetInstrumentEnabled(id int, enabled bool) {
+	s.changed = true
+	s.instruments[id].enabled = enabled
+}
+
+func (s *Synthesizer) SetInstrumentVolume(id int, volume float64) {
+	s.changed = true
+	inst := s.instruments[id]
+	inst.volume = volume
+	inst.mappedVolume = int32(math.Round(127.0 * volume))
+}
+
+// SetInstrumentPatch selects the sound font instrument.
+//
+// All drum kits are played on the same percussion channel,
+// so only one instrument can use a drum kit at a time.
+func (s *Synthesizer) SetInstrumentPatch(id int, index int) error {
+	sfInst := s.sf.Instruments[index]
+	if sfInst.IsPercussion() {
+		if other := s.PercussionInstrument(); other != -1 && other != id {
+			return fmt.Errorf("%s: instrument %d already uses a drum kit", sfInst.Name, other+1)
+		}
+	}
+	s.changed = true
+	inst := s.instruments[id]
+	inst.patchNumber = int32(sfInst.PatchNumber)
+	inst.bank = int32(sfInst.Bank)
+	inst.percussion = sfInst.IsPercussion()
+	inst.keyRange = sfInst.KeyRange
+	inst.velocity = clampInt32(defaultNoteVelocity, sfInst.VelocityRange[0], sfInst.VelocityRange[1])
+	inst.instrumentIndex = index
+	inst.kind = sfInst.Kind
+	return nil
+}
+
+// PercussionInstrument returns the ID of the instrument that uses a drum kit.
+// It returns -1 if there is no such instrument.
+func (s *Synthesizer) PercussionInstrument() int {
+	for id, inst := range s.instruments {
+		if inst.percussion {
+			return id
+		}
+	}
+	return -1
+}
+
+func (s *Synthesizer) SetInstrumentPeriod(id int, periodFunc string) error {
+	compiled, err := s.compilePeriod(periodFunc)
+	if err != nil {
+		return err
+	}
+	s.changed = true
+	s.instruments[id].SetPeriod(periodFunc, compiled)
+	return nil
+}
+
+// SetInstrumentGate changes the note duration of the instrument.
+// The gate function result is a fraction of the period;
+// an empty function means "hold the note for the entire period".
+func (s *Synthesizer) SetInstrumentGate(id int, gateFunc string) error {
+	compiled, err := compileOptionalFunc(gateFunc)
+	if err != nil {
+		return err
+	}
+	s.changed = true
+	inst := s.instruments[id]
+	inst.gateFunc = gateFunc
+	inst.compiledGate = compiled
+	return nil
+}
+
+// SetInstrumentPan changes the stereo position of the instrument.
+// The pan function result is in [-1, 1] range, where -1 is a hard left;
+// an empty function means "center".
+func (s *Synthesizer) SetInstrumentPan(id int, panFunc string) error {
+	compiled, err := compileOptionalFunc(panFunc)
+	if err != nil {
+		return err
+	}
+	s.changed = true
+	inst := s.instruments[id]
+	inst.panFunc = panFunc
+	inst.compiledPan = compiled
+	return nil
+}
+
+// SetInstrumentChord turns every instrument note into a chord.
+//
+// The chord is either a shape name (see synthdb.ChordShapeNames),
+// a list of semitone intervals like "0 3 7" or a function.
+// The function result is an interval between the stacked chord notes,
+// so "4" is a chord of 3 notes with 4 semitones between them.
+// An empty string means a single note.
+func (s *Synthesizer) SetInstrumentChord(id int, chordFunc string) error {
+	chord, ok := synthdb.ParseChord(chordFunc)
+	var compiled *exprc.FuncRunner
+	if !ok {
+		var err error
+		compiled, err = exprc.Compile(chordFunc)
+		if err != nil {
+			return err
+		}
+	}
+	s.changed = true
+	inst := s.instruments[id]
+	inst.chordFunc = chordFunc
+	inst.chord = chord
+	inst.compiledChord = compiled
+	return nil
+}
+
+// SetInstrumentGlide enables the glide mode with the given pitch bend range.
+//
+// In the glide mode, the played note follows the instrument function
+// smoothly, like a theremin, instead of a single pitch per note.
+// A zero range disables the glide mode.
+func (s *Synthesizer) SetInstrumentGlide(id int, bendRange int) {
+	s.changed = true
+	s.instruments[id].glideRange = int32(gmath.Clamp(bendRange, 0, MaxGlideRange))
+}
+
+func (s *Synthesizer) SetInstrumentReverb(id int, send float64) {
+	s.changed = true
+	s.instruments[id].reverbSend = gmath.Clamp(send, 0, 1)
+}
+
+func (s *Synthesizer) SetInstrumentChorus(id int, send float64) {
+	s.changed = true
+	s.instruments[id].chorusSend = gmath.Clamp(send, 0, 1)
+}
+
+func (s *Synthesizer) SetInstrumentFunction(id int, fx string) {
+	s.changed = true
+	s.recompileDelay = 0.75
+	s.instruments[id].SetFx(fx)
+}
+
+func (s *Synthesizer) GetInstrumentFunction(id int) *exprc.FuncRunner {
+	return s.instruments[id].compiledFx
+}
+
+func (s *Synthesizer) GetInstrumentPeriodPoints(id int) []gmath.Vec {
+	prog := s.CreateProgram(id)
+	events := s.runner.RunProgram(prog)
+	inst := s.instruments[id]
+	points := make([]gmath.Vec, 0, len(events))
+	for _, e := range events {
+		if e.ID != id {
+			continue
+		}
+		x := e.T
+		y := inst.compiledFx.Run(x)
+		points = append(points, gmath.Vec{X: x, Y: y})
+	}
+	return points
+}
+
+// compilePeriod compiles the period function with the current tempo units,
+// so the periods like "beat/2" or "3*16th" are possible.
+func (s *Synthesizer) compilePeriod(src string) (*exprc.FuncRunner, error) {
+	return exprc.CompileWithConsts(src, s.tempo.Units())
+}
+
+func compileOptionalFunc(src string) (*exprc.FuncRunner, error) {
+	if src == "" {
+		return nil, nil
+	}
+	return exprc.Compile(src)
+}
+
+func (s *Synthesizer) needsPlotRedraw() int {
+	for i, inst := range s.instruments {
+		oldFx := inst.oldFx
+		inst.oldFx = inst.fx
+		if inst.fx != oldFx {
+			return i
+		}
+		oldPeriodFunc := inst.oldPeriodFunc
+		inst.oldPeriodFunc = inst.periodFunc
+		if inst.periodFunc != oldPeriodFunc {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,94 @@
+package synth
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synthdb"
+)
+
+// LoadTrack creates a synthesizer for the track.
+//
+// The settings are applied by ApplyTrack and ApplyInstrument,
+// the game stage configures its synthesizer with them too.
+// The track functions are compiled right away,
+// an invalid period, gate, pan or chord results in an error.
+func LoadTrack(track gamedata.Track, sf *synthdb.SoundFont) (*Synthesizer, error) {
+	s := NewSynthesizer(Config{MaxInstruments: len(track.Instruments)}, sf)
+	if err := s.ApplyTrack(track); err != nil {
+		return nil, err
+	}
+	for id, inst := range track.Instruments {
+		if err := s.ApplyInstrument(id, inst); err != nil {
+			return nil, err
+		}
+	}
+
+	// The functions are compiled lazily by the game; do it right away.
+	s.ForceReload()
+
+	return s, nil
+}
+
+// ApplyTrack sets the track-wide settings: the scale and the tempo.
+//
+// An unknown scale falls back to the chromatic one.
+// All settings are applied even if some of them fail; the first error is returned.
+func (s *Synthesizer) ApplyTrack(track gamedata.Track) error {
+	var firstErr error
+	scale, ok := synthdb.ParseScale(track.ScaleRoot, track.ScaleMode)
+	if !ok {
+		firstErr = fmt.Errorf("invalid scale: %q %q", track.ScaleRoot, track.ScaleMode)
+	}
+	s.SetScale(scale)
+	if err := s.SetTempo(synthdb.ParseTempo(track.BPM, track.TimeSignature, track.SnapToGrid)); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// ApplyInstrument sets all settings of the specified instrument.
+//
+// An unknown instrument name results in the first sound font instrument.
+// All settings are applied even if some of them fail; the first error is returned.
+func (s *Synthesizer) ApplyInstrument(id int, inst gamedata.InstrumentSettings) error {
+	var firstErr error
+	setErr := func(what string, err error) {
+		if err != nil && firstErr == nil {
+			firstErr = instrumentError(id, what, err)
+		}
+	}
+
+	s.SetInstrumentFunction(id, strings.ToLower(inst.Function))
+	// The unused slots may have no period; they're never played.
+	if inst.PeriodFunction != "" {
+		setErr("period", s.SetInstrumentPeriod(id, strings.ToLower(inst.PeriodFunction)))
+	}
+	setErr("gate", s.SetInstrumentGate(id, strings.ToLower(inst.GateFunction)))
+	setErr("pan", s.SetInstrumentPan(id, strings.ToLower(inst.PanFunction)))
+	setErr("chord", s.SetInstrumentChord(id, strings.ToLower(inst.Chord)))
+	s.SetInstrumentGlide(id, inst.Glide)
+	s.SetInstrumentReverb(id, inst.ReverbSend)
+	s.SetInstrumentChorus(id, inst.ChorusSend)
+	setErr("patch", s.SetInstrumentPatch(id, findPatch(s.sf, inst.InstrumentName)))
+	s.SetInstrumentVolume(id, inst.Volume)
+	s.SetInstrumentEnabled(id, inst.Enabled)
+
+	return firstErr
+}
+
+func instrumentError(id int, what string, err error) error {
+	return fmt.Errorf("instrument %d: %s: %w", id+1, what, err)
+}
+
+// findPatch returns the instrument index by its name.
+// An unknown instrument results in the first one.
+func findPatch(sf *synthdb.SoundFont, name string) int {
+	for i, inst := range sf.Instruments {
+		if inst.Name == name {
+			return i
+		}
+	}
+	return 0
+}
@@ -0,0 +1,154 @@
+package synth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// TrackExport is a snapshot of the synthesizer state that
+// can be written to disk as a set of WAV files.
+//
+// Every enabled instrument gets its own file (a stem);
+// the stems are rendered with the instrument volume applied,
+// so their sum is identical to the master mix.
+type TrackExport struct {
+	Manifest ExportManifest
+
+	mix   *stemMixer
+	stems []*stemMixer
+}
+
+// ExportManifest describes the exported files.
+// It's written along with them as manifest.json.
+type ExportManifest struct {
+	SampleRate int          `json:"sample_rate"`
+	Length     float64      `json:"length"`
+	Mix        string       `json:"mix"`
+	MixLevels  ExportLevels `json:"mix_levels"`
+	Stems      []ExportStem `json:"stems"`
+}
+
+// ExportLevels describes the normalized mix levels.
+type ExportLevels struct {
+	// Gain is the normalization gain in dB.
+	// It's applied to the mix and to every stem,
+	// so the stems still add up to the mix.
+	Gain float64 `json:"gain"`
+
+	PeakDB float64 `json:"peak_db"`
+	RMSDB  float64 `json:"rms_db"`
+
+	// Loudness is an integrated loudness in LUFS.
+	// It's omitted for a silent mix.
+	Loudness *float64 `json:"loudness,omitempty"`
+}
+
+type ExportStem struct {
+	File string `json:"file"`
+
+	// Slot is a 1-based instrument slot index.
+	Slot int `json:"slot"`
+
+	InstrumentName string  `json:"instrument_name"`
+	PatchNumber    int     `json:"patch_number"`
+	Function       string  `json:"function"`
+	PeriodFunction string  `json:"period_function"`
+	GateFunction   string  `json:"gate_function,omitempty"`
+	PanFunction    string  `json:"pan_function,omitempty"`
+	Chord          string  `json:"chord,omitempty"`
+	Glide          int     `json:"glide,omitempty"`
+	Volume         float64 `json:"volume"`
+}
+
+// Write renders the track into the dir directory.
+// The progress function is called with [0, 1] values; it can be nil.
+// The rendering is aborted with the context error if ctx is cancelled.
+//
+// The mix is normalized to the DefaultLoudness level.
+// The stems are not limited, so they sum up to the mix
+// unless the mix limiter was engaged.
+func (e *TrackExport) Write(ctx context.Context, dir string, progress func(float64)) error {
+	if progress == nil {
+		progress = func(float64) {}
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	numFiles := float64(len(e.stems) + 1)
+	fileProgress := func(i int) func(float64) {
+		return func(p float64) {
+			progress((float64(i) + p) / numFiles)
+		}
+	}
+
+	// The mix goes first: its normalization gain is applied to the stems too.
+	mix, err := renderMixer(ctx, e.mix, fileProgress(0))
+	if err != nil {
+		return err
+	}
+	gain, stats := mix.normalize(DefaultLoudness)
+	if err := writeWAVFile(filepath.Join(dir, e.Manifest.Mix), mix); err != nil {
+		return err
+	}
+	e.Manifest.MixLevels = ExportLevels{
+		Gain:   gainToDB(gain),
+		PeakDB: gainToDB(stats.Peak),
+		RMSDB:  gainToDB(stats.RMS),
+	}
+	if !math.IsInf(stats.Loudness, -1) {
+		e.Manifest.MixLevels.Loudness = &stats.Loudness
+	}
+
+	for i, m := range e.stems {
+		m.gain = float32(gain)
+		samples, err := renderMixer(ctx, m, fileProgress(i+1))
+		if err != nil {
+			return err
+		}
+		if err := writeWAVFile(filepath.Join(dir, e.Manifest.Stems[i].File), samples); err != nil {
+			return err
+		}
+	}
+
+	manifestData, err := json.MarshalIndent(e.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "manifest.json"), manifestData, 0o644)
+}
+
+func writeWAVFile(filename string, samples *SampleSet) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := samples.WriteWAV(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// stemFileName returns a file system friendly stem name,
+// like "2_acoustic_grand_piano.wav".
+func stemFileName(slot int, instrumentName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			return unicode.ToLower(r)
+		case r == ' ' || r == '-' || r == '_':
+			return '_'
+		default:
+			return -1
+		}
+	}, instrumentName)
+	return fmt.Sprintf("%d_%s.wav", slot, name)
+}
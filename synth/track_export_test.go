@@ -0,0 +1,114 @@
+package synth
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readTestWAV(t *testing.T, filename string) []int16 {
+	t.Helper()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const headerSize = 44
+	if string(data[:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		t.Fatalf("%s: not a WAV file", filename)
+	}
+	if size := binary.LittleEndian.Uint32(data[40:]); int(size) != len(data)-headerSize {
+		t.Fatalf("%s: data size mismatch: %d vs %d", filename, size, len(data)-headerSize)
+	}
+	samples := make([]int16, (len(data)-headerSize)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[headerSize+i*2:]))
+	}
+	return samples
+}
+
+func TestTrackExport(t *testing.T) {
+	sf := loadTestSoundFont(t)
+
+	p, prog := newTestMusicPlayer(t, sf, []testInstrument{
+		{fx: "sin(x)+1", period: "0.5"},
+		{fx: "x/2", pan: "-0.5", period: "0.7"},
+	})
+	p.instruments[0].mappedVolume = 100
+	p.instruments[1].mappedVolume = 50
+
+	e := p.createExport(prog)
+	e.Manifest.Stems = []ExportStem{
+		{File: stemFileName(1, "Acoustic Grand Piano"), Slot: 1},
+		{File: stemFileName(2, "Synth Drum"), Slot: 2},
+	}
+	dir := t.TempDir()
+	progress := 0.0
+	if err := e.Write(context.Background(), dir, func(p float64) { progress = p }); err != nil {
+		t.Fatal(err)
+	}
+	if progress != 1 {
+		t.Fatalf("final progress is %f", progress)
+	}
+
+	manifestData, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Stems) != 2 || manifest.Stems[0].File != "1_acoustic_grand_piano.wav" || manifest.Stems[1].File != "2_synth_drum.wav" {
+		t.Fatalf("unexpected manifest stems: %+v", manifest.Stems)
+	}
+
+	mix := readTestWAV(t, filepath.Join(dir, manifest.Mix))
+	first := readTestWAV(t, filepath.Join(dir, manifest.Stems[0].File))
+	second := readTestWAV(t, filepath.Join(dir, manifest.Stems[1].File))
+	if len(mix) != 2*int(prog.Length*float64(manifest.SampleRate)) {
+		t.Fatalf("unexpected mix length: %d", len(mix))
+	}
+	silent := true
+	for i := range mix {
+		if mix[i] != 0 {
+			silent = false
+		}
+		// Every stem is rounded separately, so the sum can be off by one.
+		delta := int(mix[i]) - int(first[i]) - int(second[i])
+		if delta < -1 || delta > 1 {
+			t.Fatalf("sample[%d]: the stems sum is not equal to the mix: %d+%d vs %d", i, first[i], second[i], mix[i])
+		}
+	}
+	if silent {
+		t.Fatal("silent mix")
+	}
+}
+
+func TestTrackExportCancel(t *testing.T) {
+	sf := loadTestSoundFont(t)
+
+	p, prog := newTestMusicPlayer(t, sf, []testInstrument{
+		{fx: "sin(x)+1", period: "0.5"},
+	})
+	e := p.createExport(prog)
+	e.Manifest.Stems = []ExportStem{{File: stemFileName(1, "Acoustic Grand Piano"), Slot: 1}}
+
+	// Cancel the export after the first rendered chunk.
+	ctx, cancel := context.WithCancel(context.Background())
+	numCalls := 0
+	err := e.Write(ctx, t.TempDir(), func(float64) {
+		numCalls++
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if numCalls != 1 {
+		t.Fatalf("the rendering continued after the cancellation: %d progress calls", numCalls)
+	}
+}
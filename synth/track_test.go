@@ -0,0 +1,57 @@
+package synth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/quasilyte/sinecord/gamedata"
+)
+
+func TestLoadTrackDrumKits(t *testing.T) {
+	sf := goldenSoundFont(t)
+
+	drums := gamedata.InstrumentSettings{
+		Function:       "1",
+		PeriodFunction: "0.5",
+		Volume:         1,
+		InstrumentName: "Standard Kit",
+		Enabled:        true,
+	}
+	piano := drums
+	piano.InstrumentName = sf.Instruments[0].Name
+
+	if _, err := LoadTrack(gamedata.Track{Instruments: []gamedata.InstrumentSettings{piano, drums}}, sf); err != nil {
+		t.Fatal(err)
+	}
+
+	// All kits share the percussion channel.
+	_, err := LoadTrack(gamedata.Track{Instruments: []gamedata.InstrumentSettings{drums, piano, drums}}, sf)
+	if err == nil {
+		t.Fatal("a second drum kit is accepted")
+	}
+	if want := "instrument 3: patch: Standard Kit: instrument 1 already uses a drum kit"; err.Error() != want {
+		t.Fatalf("error mismatch:\nhave: %v\nwant: %s", err, want)
+	}
+
+	// The kit can be replaced by the same instrument.
+	s, err := LoadTrack(gamedata.Track{Instruments: []gamedata.InstrumentSettings{drums, piano}}, sf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kit := findPatch(sf, "Standard Kit")
+	if err := s.SetInstrumentPatch(0, kit); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetInstrumentPatch(1, kit); err == nil || !strings.Contains(err.Error(), "already uses a drum kit") {
+		t.Fatalf("expected a drum kit error, have %v", err)
+	}
+	if err := s.SetInstrumentPatch(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetInstrumentPatch(1, kit); err != nil {
+		t.Fatal(err)
+	}
+	if id := s.PercussionInstrument(); id != 1 {
+		t.Fatalf("percussion instrument: have %d, want 1", id)
+	}
+}
@@ -0,0 +1,52 @@
+package synth
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// WriteWAV encodes the samples as a 16-bit stereo PCM WAV file.
+func (set *SampleSet) WriteWAV(w io.Writer) error {
+	const (
+		numChannels   = 2
+		bitsPerSample = 16
+		headerSize    = 36
+	)
+
+	dataSize := uint32(len(set.Left) * bytesPerSample)
+	byteRate := uint32(set.PerSecond * bytesPerSample)
+
+	bw := bufio.NewWriter(w)
+	header := []any{
+		[4]byte{'R', 'I', 'F', 'F'},
+		uint32(headerSize + dataSize),
+		[4]byte{'W', 'A', 'V', 'E'},
+		[4]byte{'f', 'm', 't', ' '},
+		uint32(16), // fmt chunk size
+		uint16(1),  // PCM format
+		uint16(numChannels),
+		uint32(set.PerSecond),
+		byteRate,
+		uint16(bytesPerSample), // block align
+		uint16(bitsPerSample),
+		[4]byte{'d', 'a', 't', 'a'},
+		dataSize,
+	}
+	for _, v := range header {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	var buf [bytesPerSample]byte
+	for i := range set.Left {
+		binary.LittleEndian.PutUint16(buf[0:], uint16(pcmSample(set.Left[i])))
+		binary.LittleEndian.PutUint16(buf[2:], uint16(pcmSample(set.Right[i])))
+		if _, err := bw.Write(buf[:]); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
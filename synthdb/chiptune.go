@@ -0,0 +1,32 @@
+package synthdb
+
+import (
+	"github.com/quasilyte/sinecord/gamedata"
+)
+
+// Chiptune is a built-in font that doesn't have any SF2 data:
+// its instruments are played by the oscillator synthesizer.
+// The patch numbers select the oscillator presets.
+var Chiptune = &SoundFont{
+	Name: "chiptune",
+
+	Instruments: []*Instrument{
+		chiptuneInstrument(gamedata.OtherInstrument, "Sine Bell", 0),
+		chiptuneInstrument(gamedata.BassInstrument, "Saw Bass", 1),
+		chiptuneInstrument(gamedata.KeyboardInstrument, "Square Lead", 2),
+		chiptuneInstrument(gamedata.StringInstrument, "Saw Strings", 3),
+		chiptuneInstrument(gamedata.BrassInstrument, "Square Brass", 4),
+		chiptuneInstrument(gamedata.DrumInstrument, "Noise Drum", 5),
+	},
+}
+
+func chiptuneInstrument(kind gamedata.InstrumentKind, name string, patchNumber int) *Instrument {
+	return &Instrument{
+		Kind:          kind,
+		Name:          name,
+		Index:         patchNumber,
+		PatchNumber:   patchNumber,
+		KeyRange:      [2]int32{0, 127},
+		VelocityRange: [2]int32{0, 127},
+	}
+}
@@ -0,0 +1,122 @@
+package synthdb
+
+import (
+	"strconv"
+	"strings"
+)
+
+type ChordShape int
+
+const (
+	SingleNote ChordShape = iota
+	TriadChord
+	SeventhChord
+	PowerChord
+	CustomChord
+)
+
+var ChordShapeNames = []string{
+	SingleNote:   "single",
+	TriadChord:   "triad",
+	SeventhChord: "seventh",
+	PowerChord:   "power",
+	CustomChord:  "custom",
+}
+
+func (shape ChordShape) String() string {
+	return ChordShapeNames[shape]
+}
+
+// MaxChordNotes limits the number of notes in a custom chord.
+const MaxChordNotes = 6
+
+// chordIntervals lists the semitone offsets from the chord root.
+// They're snapped to the scale, so the triad and seventh chords
+// follow the scale: in C major, a D triad becomes a D minor.
+var chordIntervals = [...][]int32{
+	SingleNote:   {0},
+	TriadChord:   {0, 4, 7},
+	SeventhChord: {0, 4, 7, 11},
+	PowerChord:   {0, 7, 12},
+}
+
+// Chord describes the notes played by a single instrument activation.
+// A zero value is a single note.
+type Chord struct {
+	Shape ChordShape
+
+	// Intervals are the custom chord semitone offsets from the root.
+	Intervals []int32
+}
+
+// ParseChord parses the chord shape name or a custom intervals list.
+//
+// The custom intervals are separated by spaces or commas, like "0 3 7".
+// A list needs at least 2 intervals: a single number, like "7",
+// is not a list, it's a chord function with a constant result.
+// An empty string is a single note.
+// The second result is false if s is neither of these.
+func ParseChord(s string) (Chord, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Chord{}, true
+	}
+	for i, name := range ChordShapeNames {
+		if name == s && ChordShape(i) != CustomChord {
+			return Chord{Shape: ChordShape(i)}, true
+		}
+	}
+
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+	if len(fields) < 2 || len(fields) > MaxChordNotes {
+		return Chord{}, false
+	}
+	intervals := make([]int32, len(fields))
+	for i, f := range fields {
+		v, err := strconv.Atoi(f)
+		if err != nil || v < -24 || v > 24 {
+			return Chord{}, false
+		}
+		intervals[i] = int32(v)
+	}
+	return Chord{Shape: CustomChord, Intervals: intervals}, true
+}
+
+// StackedChord returns a chord of n notes separated by the same interval.
+func StackedChord(interval int32, n int) Chord {
+	intervals := make([]int32, n)
+	for i := range intervals {
+		intervals[i] = int32(i) * interval
+	}
+	return Chord{Shape: CustomChord, Intervals: intervals}
+}
+
+// Keys appends the chord note codes to dst.
+// Every chord note is snapped to the scale; the duplicates
+// and the notes outside of the MIDI range are removed.
+func (c Chord) Keys(dst []int32, root int32, scale Scale) []int32 {
+	intervals := c.Intervals
+	if c.Shape != CustomChord {
+		intervals = chordIntervals[c.Shape]
+	}
+	numKeys := len(dst)
+	for _, interval := range intervals {
+		key := scale.Quantize(root + interval)
+		if key < 0 || key > 127 {
+			continue
+		}
+		duplicate := false
+		for _, k := range dst[numKeys:] {
+			if k == key {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			dst = append(dst, key)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,84 @@
+package synthdb
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestParseChord(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+		ok   bool
+	}{
+		{s: "", want: "single []", ok: true},
+		{s: "single", want: "single []", ok: true},
+		{s: "triad", want: "triad []", ok: true},
+		{s: " power ", want: "power []", ok: true},
+		{s: "0 3 7", want: "custom [0 3 7]", ok: true},
+		{s: "0,4, 7,-12", want: "custom [0 4 7 -12]", ok: true},
+		{s: "custom", ok: false},
+		{s: "0 1 2 3 4 5 6", ok: false},
+		{s: "0 30", ok: false},
+		{s: "sin(x)", ok: false},
+
+		// A single number is a function, not an intervals list.
+		{s: "7", ok: false},
+		{s: " 7, ", ok: false},
+	}
+
+	for _, test := range tests {
+		chord, ok := ParseChord(test.s)
+		if ok != test.ok {
+			t.Fatalf("ParseChord(%q): have ok=%v, want %v", test.s, ok, test.ok)
+		}
+		if !ok {
+			continue
+		}
+		if have := fmt.Sprint(chord.Shape, " ", chord.Intervals); have != test.want {
+			t.Fatalf("ParseChord(%q):\nhave: %s\nwant: %s", test.s, have, test.want)
+		}
+	}
+}
+
+func TestChordKeys(t *testing.T) {
+	cMajor := Scale{Mode: MajorScale}
+	aMinor := Scale{Root: 9, Mode: MinorScale}
+
+	tests := []struct {
+		chord Chord
+		root  int32
+		scale Scale
+		want  string
+	}{
+		{chord: Chord{}, root: 60, want: "[60]"},
+
+		// C major, D minor, B diminished.
+		{chord: Chord{Shape: TriadChord}, root: 60, scale: cMajor, want: "[60 64 67]"},
+		{chord: Chord{Shape: TriadChord}, root: 62, scale: cMajor, want: "[62 65 69]"},
+		{chord: Chord{Shape: TriadChord}, root: 71, scale: cMajor, want: "[71 74 77]"},
+
+		// Cmaj7, G7, Am7.
+		{chord: Chord{Shape: SeventhChord}, root: 60, scale: cMajor, want: "[60 64 67 71]"},
+		{chord: Chord{Shape: SeventhChord}, root: 67, scale: cMajor, want: "[67 71 74 77]"},
+		{chord: Chord{Shape: SeventhChord}, root: 69, scale: aMinor, want: "[69 72 76 79]"},
+
+		{chord: Chord{Shape: TriadChord}, root: 60, want: "[60 64 67]"},
+		{chord: Chord{Shape: PowerChord}, root: 40, want: "[40 47 52]"},
+
+		// The duplicates and out of range keys are removed.
+		{chord: Chord{Shape: CustomChord, Intervals: []int32{0, 1, 2}}, root: 60, scale: cMajor, want: "[60 62]"},
+		{chord: Chord{Shape: PowerChord}, root: 120, want: "[120 127]"},
+		{chord: StackedChord(5, 3), root: 60, want: "[60 65 70]"},
+	}
+
+	for _, test := range tests {
+		keys := test.chord.Keys([]int32{1}, test.root, test.scale)
+		if keys[0] != 1 {
+			t.Fatal("dst prefix is overwritten")
+		}
+		if have := fmt.Sprint(keys[1:]); have != test.want {
+			t.Fatalf("%v %v at %d:\nhave: %s\nwant: %s", test.chord.Shape, test.chord.Intervals, test.root, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package synthdb
+
+import (
+	"math"
+)
+
+// PercussionBank is a General MIDI drum kits bank number.
+// The drum kits are played on a dedicated percussion channel.
+const PercussionBank = 128
+
+type DrumSound struct {
+	Name string
+	Key  int32
+}
+
+// DrumKeyMap is a curated subset of the General MIDI percussion key map.
+//
+// For the drum kits, the instrument function value selects
+// a sound from this list instead of a pitch.
+// The sounds are roughly ordered from the lowest to the highest.
+var DrumKeyMap = []DrumSound{
+	{Name: "kick", Key: 36},
+	{Name: "low tom", Key: 45},
+	{Name: "side stick", Key: 37},
+	{Name: "snare", Key: 38},
+	{Name: "clap", Key: 39},
+	{Name: "mid tom", Key: 47},
+	{Name: "high tom", Key: 50},
+	{Name: "cowbell", Key: 56},
+	{Name: "pedal hat", Key: 44},
+	{Name: "closed hat", Key: 42},
+	{Name: "open hat", Key: 46},
+	{Name: "tambourine", Key: 54},
+	{Name: "ride", Key: 51},
+	{Name: "ride bell", Key: 53},
+	{Name: "crash", Key: 49},
+}
+
+// DrumForValue maps the instrument function value to a drum key.
+// It uses the same [0, 3] values range as NoteForValue.
+// The second result is false if the value can't be played.
+func DrumForValue(y float64) (int32, bool) {
+	y = math.Abs(y)
+	if y > 3 || math.IsNaN(y) {
+		return 0, false
+	}
+	i := int(math.Round(y * float64(len(DrumKeyMap)-1) / 3))
+	return DrumKeyMap[i].Key, true
+}
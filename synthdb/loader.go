@@ -0,0 +1,114 @@
+package synthdb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/sinshu/go-meltysynth/meltysynth"
+)
+
+// SoundFonts is a list of the fonts available to the synthesizer.
+// TimGM6mb is always the first one; the user fonts are added by RegisterSoundFont.
+var SoundFonts = []*SoundFont{TimGM6mb, Chiptune}
+
+func RegisterSoundFont(sf *SoundFont) {
+	SoundFonts = append(SoundFonts, sf)
+}
+
+// FindSoundFont returns a registered font by its name.
+// An empty or unknown name results in the default font.
+func FindSoundFont(name string) *SoundFont {
+	for _, sf := range SoundFonts {
+		if sf.Name == name {
+			return sf
+		}
+	}
+	return TimGM6mb
+}
+
+// LoadSoundFont reads an SF2 file and makes all of its presets available.
+//
+// Unlike the curated TimGM6mb instruments list,
+// the presets are classified automatically, see ClassifyPreset.
+func LoadSoundFont(name string, r io.Reader) (*SoundFont, error) {
+	data, err := meltysynth.NewSoundFont(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sf := &SoundFont{Name: name}
+	for i, p := range data.Presets {
+		if p.BankNumber > PercussionBank {
+			continue
+		}
+		presetName := strings.TrimSpace(p.Name)
+		if presetName == "" {
+			presetName = fmt.Sprintf("%d:%d", p.BankNumber, p.PatchNumber)
+		}
+		sf.Instruments = append(sf.Instruments, &Instrument{
+			Kind:        ClassifyPreset(int(p.BankNumber), int(p.PatchNumber)),
+			Name:        presetName,
+			Index:       i,
+			PatchNumber: int(p.PatchNumber),
+			Bank:        int(p.BankNumber),
+		})
+	}
+	if len(sf.Instruments) == 0 {
+		return nil, fmt.Errorf("%s: no usable presets", name)
+	}
+	sort.SliceStable(sf.Instruments, func(i, j int) bool {
+		x := sf.Instruments[i]
+		y := sf.Instruments[j]
+		if x.Bank != y.Bank {
+			return x.Bank < y.Bank
+		}
+		return x.PatchNumber < y.PatchNumber
+	})
+
+	if err := sf.Load(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return sf, nil
+}
+
+// ClassifyPreset maps a preset to an instrument kind
+// using the General MIDI patch families.
+func ClassifyPreset(bank, patchNumber int) gamedata.InstrumentKind {
+	if bank == PercussionBank {
+		return gamedata.DrumInstrument
+	}
+
+	switch {
+	case patchNumber < 24: // Piano, chromatic percussion, organ
+		return gamedata.KeyboardInstrument
+	case patchNumber < 32: // Guitar
+		return gamedata.StringInstrument
+	case patchNumber < 40: // Bass
+		return gamedata.BassInstrument
+	case patchNumber == 47: // Timpani
+		return gamedata.DrumInstrument
+	case patchNumber < 52: // Strings, string ensembles
+		return gamedata.StringInstrument
+	case patchNumber < 56: // Choir, voice, orchestra hit
+		return gamedata.OtherInstrument
+	case patchNumber < 80: // Brass, reed, pipe
+		return gamedata.BrassInstrument
+	case patchNumber < 88: // Synth lead
+		return gamedata.BassInstrument
+	case patchNumber < 96: // Synth pad
+		return gamedata.KeyboardInstrument
+	case patchNumber < 104: // Synth effects
+		return gamedata.OtherInstrument
+	case patchNumber < 112: // Ethnic
+		return gamedata.StringInstrument
+	case patchNumber == 112: // Tinkle bell
+		return gamedata.OtherInstrument
+	case patchNumber < 120: // Percussive
+		return gamedata.DrumInstrument
+	default: // Sound effects
+		return gamedata.OtherInstrument
+	}
+}
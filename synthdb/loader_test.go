@@ -0,0 +1,130 @@
+package synthdb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/quasilyte/sinecord/gamedata"
+	"github.com/quasilyte/sinecord/synthdb/sf2test"
+)
+
+func TestClassifyPreset(t *testing.T) {
+	tests := []struct {
+		bank  int
+		patch int
+		kind  gamedata.InstrumentKind
+	}{
+		{0, 0, gamedata.KeyboardInstrument},  // Acoustic Grand Piano
+		{0, 19, gamedata.KeyboardInstrument}, // Church Organ
+		{0, 25, gamedata.StringInstrument},   // Acoustic Guitar (steel)
+		{0, 33, gamedata.BassInstrument},     // Electric Bass (finger)
+		{0, 40, gamedata.StringInstrument},   // Violin
+		{0, 47, gamedata.DrumInstrument},     // Timpani
+		{0, 52, gamedata.OtherInstrument},    // Choir Aahs
+		{0, 56, gamedata.BrassInstrument},    // Trumpet
+		{0, 73, gamedata.BrassInstrument},    // Flute
+		{0, 81, gamedata.BassInstrument},     // Lead 2 (sawtooth)
+		{0, 90, gamedata.KeyboardInstrument}, // Pad 3 (polysynth)
+		{0, 97, gamedata.OtherInstrument},    // FX 2 (soundtrack)
+		{0, 107, gamedata.StringInstrument},  // Koto
+		{0, 112, gamedata.OtherInstrument},   // Tinkle Bell
+		{0, 116, gamedata.DrumInstrument},    // Taiko Drum
+		{0, 127, gamedata.OtherInstrument},   // Gunshot
+		{8, 4, gamedata.KeyboardInstrument},  // Variation bank
+		{128, 0, gamedata.DrumInstrument},    // Standard Kit
+		{128, 25, gamedata.DrumInstrument},   // TR-808 Kit
+	}
+
+	for _, test := range tests {
+		have := ClassifyPreset(test.bank, test.patch)
+		if have != test.kind {
+			t.Errorf("ClassifyPreset(%d, %d):\nhave: %v\nwant: %v", test.bank, test.patch, have, test.kind)
+		}
+	}
+}
+
+func TestLoadSoundFont(t *testing.T) {
+	presets := []sf2test.Preset{
+		{Name: "Kit", Bank: 128, Patch: 0},
+		{Name: "Lead", Patch: 80},
+		{Name: "Piano", Patch: 0, KeyRange: [2]uint8{48, 72}, VelocityRange: [2]uint8{20, 100}},
+		{Name: "Bass", Patch: 33},
+	}
+	sf, err := LoadSoundFont("test", bytes.NewReader(sf2test.Generate(presets)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		name          string
+		kind          gamedata.InstrumentKind
+		keyRange      [2]int32
+		velocityRange [2]int32
+	}{
+		{"Piano", gamedata.KeyboardInstrument, [2]int32{48, 72}, [2]int32{20, 100}},
+		{"Bass", gamedata.BassInstrument, [2]int32{0, 127}, [2]int32{0, 127}},
+		{"Lead", gamedata.BassInstrument, [2]int32{0, 127}, [2]int32{0, 127}},
+		{"Kit", gamedata.DrumInstrument, [2]int32{0, 127}, [2]int32{0, 127}},
+	}
+	if len(sf.Instruments) != len(want) {
+		t.Fatalf("expected %d instruments, got %d", len(want), len(sf.Instruments))
+	}
+	for i, inst := range sf.Instruments {
+		w := want[i]
+		if inst.Name != w.name || inst.Kind != w.kind || inst.KeyRange != w.keyRange || inst.VelocityRange != w.velocityRange {
+			t.Errorf("instrument[%d] mismatch:\nhave: %+v\nwant: %+v", i, *inst, w)
+		}
+		if sf.Data.Presets[inst.Index].Name != inst.Name {
+			t.Errorf("instrument[%d] has invalid preset index %d", i, inst.Index)
+		}
+	}
+	if !sf.Instruments[3].IsPercussion() {
+		t.Errorf("%s is expected to be a percussion instrument", sf.Instruments[3].Name)
+	}
+}
+
+func TestLoadCuratedDrumKits(t *testing.T) {
+	sf := &SoundFont{
+		Name: "curated",
+		Instruments: []*Instrument{
+			{Kind: gamedata.BassInstrument, Name: "Bass", Index: 1},
+			{Kind: gamedata.DrumInstrument, Name: "Standard Kit", Bank: PercussionBank, PatchNumber: 0},
+			{Kind: gamedata.DrumInstrument, Name: "Power Kit", Bank: PercussionBank, PatchNumber: 16},
+		},
+	}
+	data, err := LoadSoundFont("data", bytes.NewReader(sf2test.Generate(sf2test.GM())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sf.Load(data.Data); err != nil {
+		t.Fatal(err)
+	}
+	// The fixture has no Power Kit.
+	if len(sf.Instruments) != 2 {
+		t.Fatalf("expected 2 instruments, got %d", len(sf.Instruments))
+	}
+	kit := sf.Instruments[1]
+	if kit.Index != 128 || !kit.IsPercussion() {
+		t.Fatalf("unexpected drum kit: %+v", *kit)
+	}
+}
+
+func TestLoadDuplicateDrumKits(t *testing.T) {
+	// Both kits are found as the first preset with the same numbers.
+	presets := []sf2test.Preset{
+		{Name: "Kit", Bank: 128, Patch: 0},
+		{Name: "Kit Copy", Bank: 128, Patch: 0},
+		{Name: "Piano", Patch: 0},
+	}
+	sf, err := LoadSoundFont("test", bytes.NewReader(sf2test.Generate(presets)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sf.Instruments) != 2 {
+		t.Fatalf("expected 2 instruments, got %d", len(sf.Instruments))
+	}
+	kit := sf.Instruments[1]
+	if kit.Name != "Kit" || kit.Index != 0 || !kit.IsPercussion() {
+		t.Fatalf("unexpected drum kit: %+v", *kit)
+	}
+}
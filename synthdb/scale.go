@@ -0,0 +1,141 @@
+package synthdb
+
+import (
+	"math"
+	"strings"
+)
+
+type ScaleMode int
+
+const (
+	ChromaticScale ScaleMode = iota
+	MajorScale
+	MinorScale
+	PentatonicScale
+	BluesScale
+	DorianScale
+	WholeToneScale
+)
+
+var ScaleModeNames = []string{
+	ChromaticScale:  "chromatic",
+	MajorScale:      "major",
+	MinorScale:      "minor",
+	PentatonicScale: "pentatonic",
+	BluesScale:      "blues",
+	DorianScale:     "dorian",
+	WholeToneScale:  "whole-tone",
+}
+
+var ScaleRootNames = []string{
+	"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B",
+}
+
+// scaleDegrees lists the semitone offsets from the scale root.
+var scaleDegrees = [...][]int{
+	ChromaticScale:  {0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+	MajorScale:      {0, 2, 4, 5, 7, 9, 11},
+	MinorScale:      {0, 2, 3, 5, 7, 8, 10},
+	PentatonicScale: {0, 2, 4, 7, 9},
+	BluesScale:      {0, 3, 5, 6, 7, 10},
+	DorianScale:     {0, 2, 3, 5, 7, 9, 10},
+	WholeToneScale:  {0, 2, 4, 6, 8, 10},
+}
+
+func (m ScaleMode) String() string {
+	return ScaleModeNames[m]
+}
+
+type Scale struct {
+	// Root is a pitch class of the scale tonic (0 is C, 11 is B).
+	Root int
+
+	Mode ScaleMode
+}
+
+// ParseScale converts the track scale settings into a Scale.
+// The empty values result in a C chromatic scale.
+// The second result is false if the root or the mode is unknown.
+func ParseScale(root, mode string) (Scale, bool) {
+	var s Scale
+	if root != "" {
+		i := indexFold(ScaleRootNames, root)
+		if i == -1 {
+			return Scale{}, false
+		}
+		s.Root = i
+	}
+	if mode != "" {
+		i := indexFold(ScaleModeNames, mode)
+		if i == -1 {
+			return Scale{}, false
+		}
+		s.Mode = ScaleMode(i)
+	}
+	return s, true
+}
+
+func indexFold(names []string, s string) int {
+	for i, name := range names {
+		if strings.EqualFold(name, s) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s Scale) RootName() string {
+	return ScaleRootNames[s.Root]
+}
+
+// Quantize snaps the note to the nearest scale degree.
+// When two degrees are equally close, the lower one is selected.
+func (s Scale) Quantize(code int32) int32 {
+	if s.Mode == ChromaticScale {
+		return code
+	}
+	offset := int((code - int32(s.Root)) % 12)
+	if offset < 0 {
+		offset += 12
+	}
+	bestDelta := 12
+	for _, degree := range scaleDegrees[s.Mode] {
+		// The next octave tonic is checked separately below.
+		delta := degree - offset
+		if absInt(delta) < absInt(bestDelta) || (absInt(delta) == absInt(bestDelta) && delta < bestDelta) {
+			bestDelta = delta
+		}
+	}
+	if delta := 12 - offset; delta < absInt(bestDelta) {
+		bestDelta = delta
+	}
+	return code + int32(bestDelta)
+}
+
+// NoteForValue maps the instrument function value to a note code.
+// The [0, 3] values range covers 4 octaves.
+// The second result is false if the value can't be played.
+func NoteForValue(y float64, scale Scale) (int32, bool) {
+	pitch, ok := PitchForValue(y)
+	if !ok {
+		return 0, false
+	}
+	return scale.Quantize(int32(math.Round(pitch))), true
+}
+
+// PitchForValue is like NoteForValue, but the result is a fractional
+// note code that is not snapped to the scale.
+func PitchForValue(y float64) (float64, bool) {
+	y = math.Abs(y)
+	if y > 3 || math.IsNaN(y) {
+		return 0, false
+	}
+	return y*float64(Ocvate4EndCode-Octave1StartCode+1)/3 + Octave1StartCode, true
+}
+
+func absInt(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
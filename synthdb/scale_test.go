@@ -0,0 +1,169 @@
+package synthdb
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScaleQuantize(t *testing.T) {
+	tests := []struct {
+		scale Scale
+		code  int32
+		want  int32
+	}{
+		// The chromatic scale keeps every note.
+		{Scale{Mode: ChromaticScale}, 61, 61},
+		{Scale{Root: 5, Mode: ChromaticScale}, -7, -7},
+
+		// C major: 0 2 4 5 7 9 11.
+		{Scale{Mode: MajorScale}, 64, 64},
+		{Scale{Mode: MajorScale}, 61, 60}, // C# is between C and D
+		{Scale{Mode: MajorScale}, 66, 65}, // F# is between F and G
+		{Scale{Mode: MajorScale}, 71, 71},
+		{Scale{Mode: MajorScale}, -1, -1}, // B below the zero C
+		{Scale{Mode: MajorScale}, -6, -7}, // F# is between F and G
+
+		// D minor: 2 4 5 7 9 10 0.
+		{Scale{Root: 2, Mode: MinorScale}, 63, 62}, // D# is between D and E
+		{Scale{Root: 2, Mode: MinorScale}, 61, 60}, // C# is between C and D
+		{Scale{Root: 2, Mode: MinorScale}, 70, 70},
+		{Scale{Root: 2, Mode: MinorScale}, -9, -10}, // D#: offset 1 is between 0 and 2
+
+		// C pentatonic: 0 2 4 7 9.
+		{Scale{Mode: PentatonicScale}, 71, 72}, // B is closer to the next C
+		{Scale{Mode: PentatonicScale}, 70, 69},
+		{Scale{Mode: PentatonicScale}, 66, 67},
+		{Scale{Mode: PentatonicScale}, 65, 64},
+		{Scale{Mode: PentatonicScale}, -1, 0},
+
+		// C blues: 0 3 5 6 7 10.
+		{Scale{Mode: BluesScale}, 71, 70}, // B is between A# and the next C
+		{Scale{Mode: BluesScale}, 61, 60},
+		{Scale{Mode: BluesScale}, 66, 66},
+		{Scale{Mode: BluesScale}, -4, -5}, // G# is closer to G than to A#
+
+		// A dorian: 9 11 0 2 4 6 7.
+		{Scale{Root: 9, Mode: DorianScale}, 70, 69},
+		{Scale{Root: 9, Mode: DorianScale}, 68, 67}, // G# is between G and A
+		{Scale{Root: 9, Mode: DorianScale}, 66, 66},
+		{Scale{Root: 9, Mode: DorianScale}, -3, -3},
+
+		// C whole-tone: 0 2 4 6 8 10.
+		{Scale{Mode: WholeToneScale}, 71, 70}, // B is between A# and the next C
+		{Scale{Mode: WholeToneScale}, 72, 72},
+		{Scale{Mode: WholeToneScale}, 61, 60},
+		{Scale{Mode: WholeToneScale}, -13, -14},
+	}
+
+	for _, test := range tests {
+		if have := test.scale.Quantize(test.code); have != test.want {
+			t.Fatalf("%s %s: Quantize(%d): have %d, want %d",
+				test.scale.RootName(), test.scale.Mode, test.code, have, test.want)
+		}
+	}
+}
+
+func TestScaleQuantizeNearest(t *testing.T) {
+	for mode := range ScaleModeNames {
+		for root := range ScaleRootNames {
+			scale := Scale{Root: root, Mode: ScaleMode(mode)}
+			for code := int32(-30); code < 130; code++ {
+				have := scale.Quantize(code)
+				if !scale.hasNote(have) {
+					t.Fatalf("%s %s: Quantize(%d)=%d is not in the scale", scale.RootName(), scale.Mode, code, have)
+				}
+				// No scale note can be strictly closer.
+				delta := absInt(int(have - code))
+				for other := code - int32(delta) + 1; other < code+int32(delta); other++ {
+					if scale.hasNote(other) {
+						t.Fatalf("%s %s: Quantize(%d)=%d, but %d is closer", scale.RootName(), scale.Mode, code, have, other)
+					}
+				}
+			}
+		}
+	}
+}
+
+func (s Scale) hasNote(code int32) bool {
+	offset := (int(code) - s.Root) % 12
+	if offset < 0 {
+		offset += 12
+	}
+	for _, degree := range scaleDegrees[s.Mode] {
+		if degree == offset {
+			return true
+		}
+	}
+	return false
+}
+
+func TestNoteForValue(t *testing.T) {
+	tests := []struct {
+		y     float64
+		scale Scale
+		want  int32
+		ok    bool
+	}{
+		{y: 0, want: Octave1StartCode, ok: true},
+		{y: 3, want: Ocvate4EndCode + 1, ok: true},
+		{y: -3, want: Ocvate4EndCode + 1, ok: true},
+		{y: 1, want: 52, ok: true},
+		{y: 1, scale: Scale{Mode: PentatonicScale}, want: 52, ok: true},
+		{y: 1.0625, want: 53, ok: true},
+		{y: 1.0625, scale: Scale{Mode: PentatonicScale}, want: 52, ok: true},
+		{y: 3.01, ok: false},
+		{y: math.NaN(), ok: false},
+		{y: math.Inf(-1), ok: false},
+	}
+
+	for _, test := range tests {
+		have, ok := NoteForValue(test.y, test.scale)
+		if ok != test.ok {
+			t.Fatalf("NoteForValue(%v): have ok=%v, want %v", test.y, ok, test.ok)
+		}
+		if ok && have != test.want {
+			t.Fatalf("NoteForValue(%v): have %d, want %d", test.y, have, test.want)
+		}
+	}
+}
+
+func TestParseScale(t *testing.T) {
+	for root, rootName := range ScaleRootNames {
+		for mode, modeName := range ScaleModeNames {
+			scale, ok := ParseScale(rootName, modeName)
+			if !ok {
+				t.Fatalf("ParseScale(%q, %q) failed", rootName, modeName)
+			}
+			if scale.Root != root || scale.Mode != ScaleMode(mode) {
+				t.Fatalf("ParseScale(%q, %q): have %+v", rootName, modeName, scale)
+			}
+			if scale.RootName() != rootName || scale.Mode.String() != modeName {
+				t.Fatalf("%+v: have names %q %q", scale, scale.RootName(), scale.Mode)
+			}
+		}
+	}
+
+	tests := []struct {
+		root string
+		mode string
+		want Scale
+		ok   bool
+	}{
+		{root: "", mode: "", want: Scale{}, ok: true},
+		{root: "d#", mode: "", want: Scale{Root: 3}, ok: true},
+		{root: "", mode: "Minor", want: Scale{Mode: MinorScale}, ok: true},
+		{root: "H", mode: "major", ok: false},
+		{root: "C", mode: "lydian", ok: false},
+		{root: "C ", mode: "major", ok: false},
+		{root: "Db", mode: "major", ok: false},
+	}
+	for _, test := range tests {
+		have, ok := ParseScale(test.root, test.mode)
+		if ok != test.ok {
+			t.Fatalf("ParseScale(%q, %q): have ok=%v, want %v", test.root, test.mode, ok, test.ok)
+		}
+		if ok && have != test.want {
+			t.Fatalf("ParseScale(%q, %q): have %+v, want %+v", test.root, test.mode, have, test.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// Package sf2test generates tiny SoundFont files for tests.
+//
+// Every generated preset plays the same looped sine wave sample,
+// so the files are only a few kilobytes long.
+package sf2test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+type Preset struct {
+	Name  string
+	Bank  int
+	Patch int
+
+	// KeyRange and VelocityRange limit the preset region.
+	// A zero value means the full [0, 127] range.
+	KeyRange      [2]uint8
+	VelocityRange [2]uint8
+}
+
+// GM returns a General MIDI compatible presets list:
+// 128 melodic presets plus a standard drum kit.
+func GM() []Preset {
+	presets := make([]Preset, 0, 129)
+	for patch := 0; patch < 128; patch++ {
+		presets = append(presets, Preset{Name: fmt.Sprintf("Preset %03d", patch), Patch: patch})
+	}
+	presets = append(presets, Preset{Name: "Standard Kit", Bank: 128})
+	return presets
+}
+
+const (
+	samplePeriod = 100 // ~441Hz at 44100 sample rate
+	sampleLength = samplePeriod * 100
+)
+
+const (
+	genKeyRange      = 43
+	genVelocityRange = 44
+	genInstrument    = 41
+	genSampleModes   = 54
+	genSampleID      = 53
+)
+
+// Generate returns an SF2 file data with the given presets.
+func Generate(presets []Preset) []byte {
+	var body bytes.Buffer
+	body.WriteString("sfbk")
+	body.Write(list("INFO",
+		chunk("ifil", le(uint16(2), uint16(1))),
+		chunk("isng", []byte("EMU8000\x00")),
+		chunk("INAM", []byte("sf2test\x00"))))
+	body.Write(list("sdta", chunk("smpl", sineSample())))
+	body.Write(parameters(presets))
+	return chunk("RIFF", body.Bytes())
+}
+
+func sineSample() []byte {
+	// The sample data must be followed by at least 46 zero samples.
+	samples := make([]int16, sampleLength+46)
+	for i := 0; i < sampleLength; i++ {
+		samples[i] = int16(12000 * math.Sin(2*math.Pi*float64(i)/samplePeriod))
+	}
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, samples)
+	return buf.Bytes()
+}
+
+func parameters(presets []Preset) []byte {
+	var phdr, pbag, pgen bytes.Buffer
+	numGenerators := 0
+	for i, p := range presets {
+		phdr.Write(name20(p.Name))
+		phdr.Write(le(uint16(p.Patch), uint16(p.Bank), uint16(i), uint32(0), uint32(0), uint32(0)))
+		pbag.Write(le(uint16(numGenerators), uint16(0)))
+		if p.KeyRange != [2]uint8{} {
+			pgen.Write(le(uint16(genKeyRange), p.KeyRange[0], p.KeyRange[1]))
+			numGenerators++
+		}
+		if p.VelocityRange != [2]uint8{} {
+			pgen.Write(le(uint16(genVelocityRange), p.VelocityRange[0], p.VelocityRange[1]))
+			numGenerators++
+		}
+		pgen.Write(le(uint16(genInstrument), uint16(0)))
+		numGenerators++
+	}
+	phdr.Write(name20("EOP"))
+	phdr.Write(le(uint16(0), uint16(0), uint16(len(presets)), uint32(0), uint32(0), uint32(0)))
+	pbag.Write(le(uint16(numGenerators), uint16(0)))
+	pgen.Write(le(uint16(0), uint16(0)))
+
+	var inst, ibag, igen bytes.Buffer
+	inst.Write(name20("sine"))
+	inst.Write(le(uint16(0)))
+	inst.Write(name20("EOI"))
+	inst.Write(le(uint16(1)))
+	ibag.Write(le(uint16(0), uint16(0)))
+	ibag.Write(le(uint16(2), uint16(0)))
+	igen.Write(le(uint16(genSampleModes), uint16(1))) // Continuous loop
+	igen.Write(le(uint16(genSampleID), uint16(0)))
+	igen.Write(le(uint16(0), uint16(0)))
+
+	var shdr bytes.Buffer
+	shdr.Write(name20("sine"))
+	// The original pitch is A4 (440Hz) with -29 cents correction for 441Hz wave.
+	shdr.Write(le(uint32(0), uint32(sampleLength), uint32(0), uint32(sampleLength), uint32(44100), uint8(69), int8(-29), uint16(0), uint16(1)))
+	shdr.Write(name20("EOS"))
+	shdr.Write(make([]byte, 26))
+
+	return list("pdta",
+		chunk("phdr", phdr.Bytes()),
+		chunk("pbag", pbag.Bytes()),
+		chunk("pmod", make([]byte, 10)),
+		chunk("pgen", pgen.Bytes()),
+		chunk("inst", inst.Bytes()),
+		chunk("ibag", ibag.Bytes()),
+		chunk("imod", make([]byte, 10)),
+		chunk("igen", igen.Bytes()),
+		chunk("shdr", shdr.Bytes()))
+}
+
+func chunk(id string, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(id)
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	return buf.Bytes()
+}
+
+func list(listType string, chunks ...[]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(listType)
+	for _, c := range chunks {
+		buf.Write(c)
+	}
+	return chunk("LIST", buf.Bytes())
+}
+
+func name20(s string) []byte {
+	b := make([]byte, 20)
+	copy(b, s)
+	return b
+}
+
+func le(values ...any) []byte {
+	var buf bytes.Buffer
+	for _, v := range values {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
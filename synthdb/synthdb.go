@@ -1,6 +1,8 @@
 package synthdb
 
 import (
+	"fmt"
+
 	"github.com/quasilyte/sinecord/gamedata"
 	"github.com/sinshu/go-meltysynth/meltysynth"
 )
@@ -10,6 +12,8 @@ type SoundFont struct {
 
 	Instruments []*Instrument
 
+	// Data is nil for the fonts that are played by
+	// the oscillator synthesizer, like Chiptune.
 	Data *meltysynth.SoundFont
 }
 
@@ -20,6 +24,20 @@ type Instrument struct {
 
 	Index       int
 	PatchNumber int
+
+	// Bank is a preset bank number, drum kits use PercussionBank.
+	// The curated drum kits are resolved by their patch numbers,
+	// the Index is assigned by Load.
+	Bank int
+
+	// KeyRange and VelocityRange are inclusive ranges
+	// the preset regions respond to; they are assigned by Load.
+	KeyRange      [2]int32
+	VelocityRange [2]int32
+}
+
+func (inst *Instrument) IsPercussion() bool {
+	return inst.Bank == PercussionBank
 }
 
 var TimGM6mb = &SoundFont{
@@ -69,6 +87,11 @@ var TimGM6mb = &SoundFont{
 		{Kind: gamedata.DrumInstrument, Name: "Taiko Drum", Index: 20},
 		{Kind: gamedata.DrumInstrument, Name: "Steel Drum", Index: 22},
 		{Kind: gamedata.DrumInstrument, Name: "Tom Drum", Index: 19},
+		{Kind: gamedata.DrumInstrument, Name: "Standard Kit", Bank: PercussionBank, PatchNumber: 0},
+		{Kind: gamedata.DrumInstrument, Name: "Room Kit", Bank: PercussionBank, PatchNumber: 8},
+		{Kind: gamedata.DrumInstrument, Name: "Power Kit", Bank: PercussionBank, PatchNumber: 16},
+		{Kind: gamedata.DrumInstrument, Name: "Electronic Kit", Bank: PercussionBank, PatchNumber: 24},
+		{Kind: gamedata.DrumInstrument, Name: "TR-808 Kit", Bank: PercussionBank, PatchNumber: 25},
 
 		{Kind: gamedata.OtherInstrument, Name: "Tinker Bell", Index: 24},
 		{Kind: gamedata.OtherInstrument, Name: "Voice Oohs", Index: 78},
@@ -77,33 +100,93 @@ var TimGM6mb = &SoundFont{
 	},
 }
 
-func (sf *SoundFont) Load(data *meltysynth.SoundFont) {
+func (sf *SoundFont) Load(data *meltysynth.SoundFont) error {
 	sf.Data = data
 
 	presets := map[int]bool{}
 
+	// Not every font has all of the GM drum kits;
+	// the missing ones are removed from the instruments list.
+	instruments := sf.Instruments[:0]
 	for _, inst := range sf.Instruments {
+		if inst.IsPercussion() {
+			index := findPreset(data, inst.Bank, inst.PatchNumber)
+			if index == -1 {
+				continue
+			}
+			inst.Index = index
+		}
+
+		if inst.Index < 0 || inst.Index >= len(data.Presets) {
+			return fmt.Errorf("%s: preset index %d is out of range", inst.Name, inst.Index)
+		}
+		// The drum kits are found by their bank and patch numbers,
+		// so the presets with the same numbers end up here; the first one is kept.
 		if presets[inst.Index] {
-			panic("found duplicated preset")
+			continue
 		}
 		presets[inst.Index] = true
+		instruments = append(instruments, inst)
 
 		instInfo := data.Presets[inst.Index]
 		inst.PatchNumber = int(instInfo.PatchNumber)
 
-		for _, region := range instInfo.Regions {
-			if region.GetVelocityRangeStart() != 0 {
-				panic("unexpected velocity range start")
-			}
-			if region.GetVelocityRangeEnd() != 127 {
-				panic("unexpected velocity range end")
-			}
-			if region.GetKeyRangeStart() != 0 {
-				panic("unexpected key range start")
-			}
-			if region.GetKeyRangeEnd() != 127 {
-				panic("unexpected key range end")
+		keyRange, velocityRange, ok := presetRanges(instInfo)
+		if !ok {
+			return fmt.Errorf("%s: preset has no playable regions", inst.Name)
+		}
+		inst.KeyRange = keyRange
+		inst.VelocityRange = velocityRange
+	}
+	sf.Instruments = instruments
+
+	return nil
+}
+
+// presetRanges computes the key and velocity ranges covered by the preset.
+// A preset region only sounds where its instrument regions are defined,
+// so the ranges are intersected.
+func presetRanges(p *meltysynth.Preset) (keyRange, velocityRange [2]int32, ok bool) {
+	keyRange = [2]int32{127, 0}
+	velocityRange = [2]int32{127, 0}
+	for _, presetRegion := range p.Regions {
+		for _, instRegion := range presetRegion.Instrument.Regions {
+			keyFrom := max32(presetRegion.GetKeyRangeStart(), instRegion.GetKeyRangeStart())
+			keyTo := min32(presetRegion.GetKeyRangeEnd(), instRegion.GetKeyRangeEnd())
+			velocityFrom := max32(presetRegion.GetVelocityRangeStart(), instRegion.GetVelocityRangeStart())
+			velocityTo := min32(presetRegion.GetVelocityRangeEnd(), instRegion.GetVelocityRangeEnd())
+			if keyFrom > keyTo || velocityFrom > velocityTo {
+				continue
 			}
+			ok = true
+			keyRange[0] = min32(keyRange[0], keyFrom)
+			keyRange[1] = max32(keyRange[1], keyTo)
+			velocityRange[0] = min32(velocityRange[0], velocityFrom)
+			velocityRange[1] = max32(velocityRange[1], velocityTo)
+		}
+	}
+	return keyRange, velocityRange, ok
+}
+
+func min32(x, y int32) int32 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+func max32(x, y int32) int32 {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+func findPreset(data *meltysynth.SoundFont, bank, patchNumber int) int {
+	for i, p := range data.Presets {
+		if int(p.BankNumber) == bank && int(p.PatchNumber) == patchNumber {
+			return i
 		}
 	}
+	return -1
 }
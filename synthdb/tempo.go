@@ -0,0 +1,123 @@
+package synthdb
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	DefaultBPM = 120
+	MinBPM     = 40
+	MaxBPM     = 240
+)
+
+var TimeSignatureNames = []string{
+	"4/4", "3/4", "2/4", "5/4", "6/8", "7/8", "12/8",
+}
+
+// Tempo describes the musical grid of a track.
+//
+// The zero value is a 120 BPM 4/4 tempo without the grid snapping.
+type Tempo struct {
+	// BPM is a number of beats per minute.
+	// The beat duration is defined by the time signature BeatUnit.
+	BPM float64
+
+	// BeatsPerBar and BeatUnit form a time signature, like 6/8.
+	BeatsPerBar int
+	BeatUnit    int
+
+	// SnapToGrid quantizes the note onsets to the 16th notes grid.
+	SnapToGrid bool
+}
+
+var DefaultTempo = Tempo{BPM: DefaultBPM, BeatsPerBar: 4, BeatUnit: 4}
+
+// ParseTempo converts the track tempo settings into a Tempo.
+// Zero or unknown values are replaced with the defaults.
+func ParseTempo(bpm float64, signature string, snap bool) Tempo {
+	t := DefaultTempo
+	t.BPM = bpm
+	t.SnapToGrid = snap
+	if t.BPM == 0 || math.IsNaN(t.BPM) {
+		t.BPM = DefaultBPM
+	}
+	t.BPM = math.Max(MinBPM, math.Min(t.BPM, MaxBPM))
+	var beats, unit int
+	if _, err := fmt.Sscanf(signature, "%d/%d", &beats, &unit); err == nil && beats > 0 && isTimeSignatureUnit(unit) {
+		t.BeatsPerBar = beats
+		t.BeatUnit = unit
+	}
+	return t
+}
+
+func isTimeSignatureUnit(unit int) bool {
+	switch unit {
+	case 2, 4, 8, 16:
+		return true
+	default:
+		return false
+	}
+}
+
+// TimeSignature returns the beats per bar and the beat unit.
+func (t Tempo) TimeSignature() (int, int) {
+	t = t.normalized()
+	return t.BeatsPerBar, t.BeatUnit
+}
+
+func (t Tempo) Signature() string {
+	beats, unit := t.TimeSignature()
+	return fmt.Sprintf("%d/%d", beats, unit)
+}
+
+func (t Tempo) normalized() Tempo {
+	if t.BPM == 0 {
+		t.BPM = DefaultBPM
+	}
+	if t.BeatsPerBar == 0 || t.BeatUnit == 0 {
+		t.BeatsPerBar = 4
+		t.BeatUnit = 4
+	}
+	return t
+}
+
+// Beat returns the beat duration in seconds.
+func (t Tempo) Beat() float64 {
+	return 60 / t.normalized().BPM
+}
+
+// Bar returns the bar duration in seconds.
+func (t Tempo) Bar() float64 {
+	return t.Beat() * float64(t.normalized().BeatsPerBar)
+}
+
+// Sixteenth returns the 16th note duration in seconds.
+func (t Tempo) Sixteenth() float64 {
+	return t.Beat() * float64(t.normalized().BeatUnit) / 16
+}
+
+// QuarterBPM returns the tempo in quarter notes per minute.
+// This is how the MIDI files measure the tempo.
+func (t Tempo) QuarterBPM() float64 {
+	t = t.normalized()
+	return t.BPM * 4 / float64(t.BeatUnit)
+}
+
+// Grid returns the notes onset quantization step.
+// A zero value is returned if the snapping is disabled.
+func (t Tempo) Grid() float64 {
+	if !t.SnapToGrid {
+		return 0
+	}
+	return t.Sixteenth()
+}
+
+// Units returns the named durations that can be used in the period functions.
+func (t Tempo) Units() map[string]float64 {
+	return map[string]float64{
+		"beat": t.Beat(),
+		"bar":  t.Bar(),
+		"16th": t.Sixteenth(),
+	}
+}